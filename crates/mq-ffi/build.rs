@@ -4,12 +4,20 @@ use std::path::Path;
 fn main() {
     let crate_dir = env::var("CARGO_MANIFEST_DIR").unwrap();
 
+    // Emit `size_t` rather than `uintptr_t` for `usize`, matching how C callers size buffers.
+    let config = cbindgen::Config {
+        usize_is_size_t: true,
+        ..Default::default()
+    };
+
     let bindings = cbindgen::Builder::new()
+        .with_config(config)
         .with_language(cbindgen::Language::C)
         .with_crate(&crate_dir)
         .with_include_guard("MQ_H")
         .rename_item("MqContext", "mq_context_t")
         .rename_item("MqResult", "mq_result_t")
+        .rename_item("MqInterruptHandle", "mq_interrupt_handle_t")
         .generate()
         .unwrap();
     bindings.write_to_file(Path::new(&crate_dir).join("mq.h"));
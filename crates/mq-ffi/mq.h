@@ -6,6 +6,82 @@
 #include <stdint.h>
 #include <stdlib.h>
 
+/**
+ * C-compatible output format used to render each result value.
+ */
+typedef enum MqOutputFormat {
+  /**
+   * Markdown text, as returned by `mq_eval`
+   */
+  MqOutputFormat_Markdown = 0,
+  /**
+   * HTML rendered from the markdown of each result
+   */
+  MqOutputFormat_Html = 1,
+  /**
+   * JSON, with markdown nodes serialized as their AST
+   */
+  MqOutputFormat_Json = 2,
+  /**
+   * Plain text of each result: link text and image alt text, without URLs or raw HTML
+   */
+  MqOutputFormat_Text = 3,
+  /**
+   * YAML, with markdown nodes serialized as their AST
+   */
+  MqOutputFormat_Yaml = 4,
+} MqOutputFormat;
+
+/**
+ * C-compatible bullet marker used when rendering markdown lists.
+ */
+typedef enum MqListStyle {
+  /**
+   * `-` marker
+   */
+  MqListStyle_Dash = 0,
+  /**
+   * `+` marker
+   */
+  MqListStyle_Plus = 1,
+  /**
+   * `*` marker
+   */
+  MqListStyle_Star = 2,
+} MqListStyle;
+
+/**
+ * C-compatible style for link URLs when rendering markdown links.
+ */
+typedef enum MqLinkUrlStyle {
+  /**
+   * `[text](url)`
+   */
+  MqLinkUrlStyle_None = 0,
+  /**
+   * `[text](<url>)`
+   */
+  MqLinkUrlStyle_Angle = 1,
+} MqLinkUrlStyle;
+
+/**
+ * C-compatible quoting for link titles when rendering markdown links.
+ */
+typedef enum MqLinkTitleStyle {
+  /**
+   * `"title"`
+   */
+  MqLinkTitleStyle_Double = 0,
+  /**
+   * `'title'`
+   */
+  MqLinkTitleStyle_Single = 1,
+  /**
+   * `(title)`
+   */
+  MqLinkTitleStyle_Paren = 2,
+} MqLinkTitleStyle;
+
 /**
  * C-compatible optimization level for AST transformations applied before evaluation.
  */
@@ -17,9 +93,11 @@ typedef enum MqOptimizationLevel {
 
 typedef void mq_context_t;
 
+typedef void mq_interrupt_handle_t;
+
 typedef struct mq_result_t {
   char **values;
-  uintptr_t values_len;
+  size_t values_len;
   char *error_msg;
 } mq_result_t;
 
@@ -41,6 +119,33 @@ typedef struct MqConversionOptions {
   bool use_title_as_h1;
 } MqConversionOptions;
 
+/**
+ * C-compatible options for `mq_eval_with_options`.
+ */
+typedef struct MqEvalOptions {
+  /**
+   * Format each result value is rendered in
+   */
+  enum MqOutputFormat output_format;
+  /**
+   * Bullet marker for lists in markdown output
+   */
+  enum MqListStyle list_style;
+  /**
+   * Surrounding of link URLs in markdown output
+   */
+  enum MqLinkUrlStyle link_url_style;
+  /**
+   * Quoting of link titles in markdown output
+   */
+  enum MqLinkTitleStyle link_title_style;
+  /**
+   * Pass raw HTML in markdown results through to `Html` output instead of escaping it.
+   * Only enable this for trusted input, as it allows `<script>` and other markup through.
+   */
+  bool allow_dangerous_html;
+} MqEvalOptions;
+
 /**
  * Creates a new mq_lang engine.
  * The caller is responsible for destroying the engine using `mq_destroy`.
@@ -65,12 +170,73 @@ void mq_destroy(mq_context_t *engine_ptr);
  * - `input_format_c` must be a valid pointer to a null-terminated C string
  * - All string pointers must remain valid for the duration of this function call
  * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ * - If the engine panics, the panic is caught and reported through `error_msg`; the engine
+ *   may be left in an inconsistent state and should be destroyed. This needs a library built
+ *   with `panic = "unwind"` (the `release-ffi` profile); in a `--release` build a panic aborts
+ *   the host process
  */
 struct mq_result_t mq_eval(mq_context_t *engine_ptr,
                            const char *code_c,
                            const char *input_c,
                            const char *input_format_c);
 
+/**
+ * Evaluates mq code with input given as a pointer and byte length instead of a
+ * null-terminated string, so input containing NUL bytes is passed through intact.
+ * The input must be valid UTF-8; otherwise an error is returned rather than truncating it.
+ * Results are still returned as C strings, so if a result value contains a NUL byte the
+ * evaluation fails with an error instead of returning a truncated value.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences raw pointers. The caller must ensure:
+ * - `engine_ptr` must be a valid pointer to an `Engine` created by `mq_create`
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - `input_ptr` must be a valid pointer to `input_len` readable bytes, or null if `input_len` is 0
+ * - `input_format_c` must be a valid pointer to a null-terminated C string
+ * - All pointers must remain valid for the duration of this function call
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_eval_bytes(mq_context_t *engine_ptr,
+                                 const char *code_c,
+                                 const uint8_t *input_ptr,
+                                 size_t input_len,
+                                 const char *input_format_c);
+
+/**
+ * Evaluates mq code with the given input, rendering each result as described by `options`.
+ * With `MqEvalOptions` zero-initialized this behaves exactly like `mq_eval`.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences raw pointers. The caller must ensure:
+ * - `engine_ptr` must be a valid pointer to an `Engine` created by `mq_create`
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - `input_c` must be a valid pointer to a null-terminated C string
+ * - `input_format_c` must be a valid pointer to a null-terminated C string
+ * - All string pointers must remain valid for the duration of this function call
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_eval_with_options(mq_context_t *engine_ptr,
+                                        const char *code_c,
+                                        const char *input_c,
+                                        const char *input_format_c,
+                                        struct MqEvalOptions options);
+
+/**
+ * Returns whether `input_format_c` names an input format accepted by `mq_eval`
+ * (case-insensitive), so callers can reject a misspelled format before evaluating.
+ * Returns false if `input_format_c` is null or not valid UTF-8.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+ * - `input_format_c` must be a valid pointer to a null-terminated C string, or null
+ */
+bool mq_is_supported_input_format(const char *input_format_c);
+
 /**
  * Frees a C string allocated by Rust.
  *
@@ -132,6 +298,23 @@ char *mq_html_to_markdown(const char *html_input_c,
                           struct MqConversionOptions options,
                           char **error_msg);
 
+/**
+ * Converts a JSON AST, as returned by the `Json` output format, back to Markdown.
+ * The input must be a JSON array of nodes or a single node object.
+ * Returns a C string containing the markdown output, or NULL on error.
+ * The caller is responsible for freeing the result using `mq_free_string`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences raw pointers. The caller must ensure:
+ * - `json_input_c` must be a valid pointer to a null-terminated C string
+ * - `error_msg` must be a valid pointer to a location where an error message pointer can be stored
+ * - The string pointer must remain valid for the duration of this function call
+ * - The returned C string must be freed using `mq_free_string` to avoid memory leaks
+ * - If an error occurs, the function returns NULL and sets `*error_msg` to an error message
+ */
+char *mq_json_to_markdown(const char *json_input_c, char **error_msg);
+
 /**
  * Returns the mq-ffi library version as a static, null-terminated string.
  */
@@ -149,6 +332,40 @@ void mq_set_optimization_level(mq_context_t *engine_ptr, enum MqOptimizationLeve
  */
 void mq_set_max_call_stack_depth(mq_context_t *engine_ptr, uint32_t max_call_stack_depth);
 
+/**
+ * Enables or disables sandbox mode on this engine for evaluating untrusted mq code.
+ *
+ * While enabled, the network (`http`) and filesystem (`read_file`, `read_file_bytes`,
+ * `collection`, `file_exists`, `write_file`) builtins and `$NAME` environment variable
+ * references are all rejected, and modules can only be loaded from the standard library
+ * (such as `csv` or `json`): neither the search paths nor HTTP imports are consulted,
+ * including the default `$HOME/.mq` and current directory paths. Modules imported with
+ * `mq_import_module` before enabling the sandbox stay available. Only this engine is
+ * affected; other engines in the process keep their settings.
+ * Has no effect if `engine_ptr` is null.
+ */
+void mq_set_sandbox(mq_context_t *engine_ptr, bool enabled);
+
+/**
+ * Returns a handle that stops the engine's running `mq_eval` call when passed to
+ * `mq_interrupt`, which may be called from any thread.
+ * The caller is responsible for freeing the handle using `mq_free_interrupt_handle`.
+ * Returns NULL if `engine_ptr` is null.
+ */
+mq_interrupt_handle_t *mq_interrupt_handle(mq_context_t *engine_ptr);
+
+/**
+ * Stops the `mq_eval` call currently running on the handle's engine, which then returns
+ * an "Execution was interrupted" error. Unlike the engine itself, the handle may be used
+ * from a different thread than the one evaluating. Has no effect if `handle_ptr` is null.
+ */
+void mq_interrupt(mq_interrupt_handle_t *handle_ptr);
+
+/**
+ * Frees a handle returned by `mq_interrupt_handle`. The handle may outlive its engine.
+ */
+void mq_free_interrupt_handle(mq_interrupt_handle_t *handle_ptr);
+
 /**
  * Sets the search paths used to resolve modules loaded via `mq_import_module`
  * or `mq_load_module`. Has no effect if `engine_ptr` is null.
@@ -161,7 +378,7 @@ void mq_set_max_call_stack_depth(mq_context_t *engine_ptr, uint32_t max_call_sta
  */
 void mq_set_search_paths(mq_context_t *engine_ptr,
                          const char *const *paths,
-                         uintptr_t paths_len);
+                         size_t paths_len);
 
 /**
  * Defines a string variable that can be referenced from mq code evaluated
@@ -220,7 +437,7 @@ char *mq_load_module(mq_context_t *engine_ptr, const char *module_name_c);
  */
 void mq_set_http_allowed_domains(mq_context_t *engine_ptr,
                                  const char *const *domains,
-                                 uintptr_t domains_len);
+                                 size_t domains_len);
 
 /**
  * Clears locally-cached HTTP module files, forcing a re-fetch of all cached
@@ -234,4 +451,87 @@ char *mq_clear_http_cache(mq_context_t *engine_ptr);
  */
 char *mq_clear_http_cache_all(mq_context_t *engine_ptr);
 
+/**
+ * Tokenizes mq code for syntax highlighting, tolerating incomplete or invalid code.
+ * Each value in the result is one token encoded as a JSON object with `kind` ("keyword",
+ * "boolean", "number", "string", "comment", "selector", "ident", "env", "punctuation" or
+ * "operator") and `range` (1-based `line` and `column` of `start` and `end`) fields.
+ * Whitespace is not included.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_tokenize(const char *code_c);
+
+/**
+ * Parses mq code without evaluating it and returns its abstract syntax tree as a single
+ * JSON value, so callers can inspect which selectors and functions a query uses (for
+ * example to validate an expensive query) before running it. The JSON format is the one
+ * produced by `mq_lang::ast_to_json`. Requires the `ast-json` feature; otherwise an error
+ * is returned.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_parse_ast(const char *code_c);
+
+/**
+ * Lints mq code without evaluating it, using the default rule set of the mq linter.
+ * Each value in the result is one finding encoded as a JSON object with `rule`,
+ * `severity` ("style", "perf", "warn" or "error"), `message`, `help`, and `range`
+ * (1-based `line` and `column` of `start` and `end`, or null) fields.
+ * Requires the `lint` feature; otherwise an error is returned.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_lint(const char *code_c);
+
+/**
+ * Lists the functions defined in mq code without evaluating it, for generating reference
+ * documentation from a script library. Each value in the result is one function encoded
+ * as a JSON object with `name`, `params`, `doc` (the `#` comment lines above the
+ * definition, joined by newlines), and `range` fields, in source order.
+ * Only named functions outside any other function are listed: lambdas (`fn(x): ...;`) and
+ * `def`s nested inside another function body are implementation details and are omitted.
+ * Requires the `analysis` feature; otherwise an error is returned.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_defined_functions(const char *code_c);
+
+/**
+ * Returns completion candidates for the cursor at `line` and `column` (1-based) in mq code:
+ * functions, macros, variables, and parameters in scope there, followed by builtin
+ * functions and selectors, without duplicates. Each value in the result is one candidate
+ * encoded as a JSON object with `label`, `kind` ("function", "variable" or "selector"),
+ * `params` (null unless a function), `doc`, and `deprecated` fields.
+ * Requires the `analysis` feature; otherwise an error is returned.
+ * The caller is responsible for freeing the result using `mq_free_result`.
+ *
+ * # Safety
+ *
+ * This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+ * - `code_c` must be a valid pointer to a null-terminated C string
+ * - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+ */
+struct mq_result_t mq_complete(const char *code_c, uint32_t line, uint32_t column);
+
 #endif  /* MQ_H */
@@ -55,18 +55,59 @@
 //! - `"mdx"` - Markdown with JSX support
 //! - `"html"` - HTML content converted to markdown
 //! - `"text"` - Plain text, split by lines
+//! - `"csv"` / `"tsv"` - Delimited data, parsed into one dict per row keyed by header
+//! - `"json"` - JSON data, parsed into mq arrays, dicts, and scalars
+//! - `"ipynb"` - Jupyter notebook, with markdown cells as markdown and code cells as code blocks
 //!
 use libc::c_void;
 use mq_lang::DefaultEngine;
-use mq_lang::{Engine, RuntimeValue};
-use mq_markdown::{ConversionOptions, convert_html_to_markdown};
+use mq_lang::{Engine, InterruptHandle, RuntimeValue, TokenKind};
+use mq_markdown::{
+    ConversionOptions, Link, LinkRef, ListStyle, Markdown, Node, RenderOptions, TitleSurroundStyle, UrlSurroundStyle,
+    convert_html_to_markdown,
+};
 use std::ffi::CStr;
 use std::ffi::CString;
 use std::os::raw::c_char;
 use std::path::PathBuf;
 use std::ptr;
 
+/// Input formats accepted by `mq_eval` by name, compared case-insensitively.
+const INPUT_FORMATS: [(&str, InputFormat); 8] = [
+    ("markdown", InputFormat::Markdown),
+    ("mdx", InputFormat::Mdx),
+    ("html", InputFormat::Html),
+    ("text", InputFormat::Text),
+    ("csv", InputFormat::Csv),
+    ("tsv", InputFormat::Tsv),
+    ("json", InputFormat::Json),
+    ("ipynb", InputFormat::Ipynb),
+];
+
+/// Format of the input passed to `mq_eval`, named as listed in `INPUT_FORMATS`.
+#[derive(Debug, Clone, Copy)]
+enum InputFormat {
+    Markdown,
+    Mdx,
+    Html,
+    Text,
+    Csv,
+    Tsv,
+    Json,
+    Ipynb,
+}
+
+impl InputFormat {
+    fn from_name(name: &str) -> Option<Self> {
+        INPUT_FORMATS
+            .iter()
+            .find(|(format_name, _)| format_name.eq_ignore_ascii_case(name))
+            .map(|&(_, format)| format)
+    }
+}
+
 pub type MqContext = c_void;
+pub type MqInterruptHandle = c_void;
 
 #[repr(C)]
 pub struct MqResult {
@@ -97,11 +138,276 @@ impl From<MqConversionOptions> for ConversionOptions {
     }
 }
 
+/// C-compatible output format used to render each result value.
+/// cbindgen:prefix-with-name
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default)]
+pub enum MqOutputFormat {
+    /// Markdown text, as returned by `mq_eval`
+    #[default]
+    Markdown = 0,
+    /// HTML rendered from the markdown of each result
+    Html = 1,
+    /// JSON, with markdown nodes serialized as their AST
+    Json = 2,
+    /// Plain text of each result: link text and image alt text, without URLs or raw HTML
+    Text = 3,
+    /// YAML, with markdown nodes serialized as their AST
+    Yaml = 4,
+}
+
+/// C-compatible bullet marker used when rendering markdown lists.
+/// cbindgen:prefix-with-name
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default)]
+pub enum MqListStyle {
+    /// `-` marker
+    #[default]
+    Dash = 0,
+    /// `+` marker
+    Plus = 1,
+    /// `*` marker
+    Star = 2,
+}
+
+impl From<MqListStyle> for ListStyle {
+    fn from(style: MqListStyle) -> Self {
+        match style {
+            MqListStyle::Dash => ListStyle::Dash,
+            MqListStyle::Plus => ListStyle::Plus,
+            MqListStyle::Star => ListStyle::Star,
+        }
+    }
+}
+
+/// C-compatible style for link URLs when rendering markdown links.
+/// cbindgen:prefix-with-name
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default)]
+pub enum MqLinkUrlStyle {
+    /// `[text](url)`
+    #[default]
+    None = 0,
+    /// `[text](<url>)`
+    Angle = 1,
+}
+
+impl From<MqLinkUrlStyle> for UrlSurroundStyle {
+    fn from(style: MqLinkUrlStyle) -> Self {
+        match style {
+            MqLinkUrlStyle::None => UrlSurroundStyle::None,
+            MqLinkUrlStyle::Angle => UrlSurroundStyle::Angle,
+        }
+    }
+}
+
+/// C-compatible quoting for link titles when rendering markdown links.
+/// cbindgen:prefix-with-name
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default)]
+pub enum MqLinkTitleStyle {
+    /// `"title"`
+    #[default]
+    Double = 0,
+    /// `'title'`
+    Single = 1,
+    /// `(title)`
+    Paren = 2,
+}
+
+impl From<MqLinkTitleStyle> for TitleSurroundStyle {
+    fn from(style: MqLinkTitleStyle) -> Self {
+        match style {
+            MqLinkTitleStyle::Double => TitleSurroundStyle::Double,
+            MqLinkTitleStyle::Single => TitleSurroundStyle::Single,
+            MqLinkTitleStyle::Paren => TitleSurroundStyle::Paren,
+        }
+    }
+}
+
+/// C-compatible options for `mq_eval_with_options`.
+#[repr(C)]
+#[derive(Debug, Clone, Copy, Default)]
+pub struct MqEvalOptions {
+    /// Format each result value is rendered in
+    pub output_format: MqOutputFormat,
+    /// Bullet marker for lists in markdown output
+    pub list_style: MqListStyle,
+    /// Surrounding of link URLs in markdown output
+    pub link_url_style: MqLinkUrlStyle,
+    /// Quoting of link titles in markdown output
+    pub link_title_style: MqLinkTitleStyle,
+    /// Pass raw HTML in markdown results through to `Html` output instead of escaping it.
+    /// Only enable this for trusted input, as it allows `<script>` and other markup through.
+    pub allow_dangerous_html: bool,
+}
+
+impl From<MqEvalOptions> for RenderOptions {
+    fn from(options: MqEvalOptions) -> Self {
+        RenderOptions {
+            list_style: options.list_style.into(),
+            link_url_style: options.link_url_style.into(),
+            link_title_style: options.link_title_style.into(),
+        }
+    }
+}
+
+// Helper function to render a result value in the output format given by `options`.
+// Each value is rendered on its own, so HTML output is one fragment per result. Values other
+// than markdown nodes are escaped as HTML text rather than parsed as markdown.
+fn render_value(value: &RuntimeValue, options: MqEvalOptions) -> String {
+    match options.output_format {
+        MqOutputFormat::Markdown => match value {
+            RuntimeValue::Markdown(node, _) => node.to_string_with(&options.into()),
+            _ => value.to_string(),
+        },
+        MqOutputFormat::Html => match value {
+            RuntimeValue::Markdown(node, _) if options.allow_dangerous_html => {
+                Markdown::new(vec![(**node).clone()]).to_html()
+            }
+            RuntimeValue::Markdown(node, _) => Markdown::new(vec![(**node).clone()]).to_safe_html(),
+            _ => html_escape(&value.to_string()),
+        },
+        MqOutputFormat::Json => {
+            serde_json::to_string(&value.clone().to_json_value()).unwrap_or_else(|_| "null".to_string())
+        }
+        MqOutputFormat::Text => match value {
+            RuntimeValue::Markdown(node, _) => plain_text(node),
+            _ => value.to_string(),
+        },
+        MqOutputFormat::Yaml => {
+            serde_yaml::to_string(&value.clone().to_json_value()).unwrap_or_else(|_| "null\n".to_string())
+        }
+    }
+}
+
+// Helper function to collect the text a reader sees in a markdown node: the text of links and
+// emphasis, the alt text of images, and nothing for raw HTML or link definitions.
+fn plain_text(node: &Node) -> String {
+    match node {
+        Node::Html(_) | Node::Definition(_) => String::new(),
+        Node::Image(image) => image.alt.clone(),
+        Node::ImageRef(image) => image.alt.clone(),
+        Node::Link(Link { values, .. }) | Node::LinkRef(LinkRef { values, .. }) => {
+            values.iter().map(plain_text).collect()
+        }
+        _ => {
+            let children = node.children();
+            if children.is_empty() {
+                node.value()
+            } else {
+                children.iter().map(plain_text).collect()
+            }
+        }
+    }
+}
+
+// Helper function to escape text for use in HTML
+fn html_escape(s: &str) -> String {
+    s.replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('>', "&gt;")
+        .replace('"', "&quot;")
+}
+
 // Helper function to convert Rust string to C string
 fn to_c_string(s: String) -> *mut c_char {
     CString::new(s).map_or_else(|_| ptr::null_mut(), |cs| cs.into_raw())
 }
 
+// Helper function to run `f`, turning a panic inside mq into an error message so it
+// never unwinds across the FFI boundary (which would abort the host process).
+// Only effective when built with `panic = "unwind"`: a debug build or the `release-ffi` profile.
+// The workspace `release` profile sets `panic = "abort"`, so in a `--release` build a panic
+// still aborts the host process before this function can catch it.
+fn catch_panic<T>(f: impl FnOnce() -> T) -> Result<T, String> {
+    std::panic::catch_unwind(std::panic::AssertUnwindSafe(f)).map_err(|payload| {
+        let reason = payload
+            .downcast_ref::<&str>()
+            .copied()
+            .or_else(|| payload.downcast_ref::<String>().map(String::as_str))
+            .unwrap_or("unknown cause");
+        format!("Internal error: mq panicked: {}", reason)
+    })
+}
+
+// Helper function to run an entry point returning `MqResult`, reporting a panic as its error.
+fn catch_panic_result(f: impl FnOnce() -> MqResult) -> MqResult {
+    catch_panic(f).unwrap_or_else(|msg| MqResult {
+        values: ptr::null_mut(),
+        values_len: 0,
+        error_msg: to_c_string(msg),
+    })
+}
+
+// Helper function to run an entry point returning a C string, storing its error or panic
+// message in `error_msg` (if given) and returning NULL instead.
+fn catch_panic_c_string(
+    error_msg: Option<&mut *mut c_char>,
+    f: impl FnOnce() -> Result<String, String>,
+) -> *mut c_char {
+    match catch_panic(f).and_then(|result| result) {
+        Ok(s) => to_c_string(s),
+        Err(msg) => {
+            if let Some(error_msg) = error_msg {
+                *error_msg = to_c_string(msg);
+            }
+            ptr::null_mut()
+        }
+    }
+}
+
+// Helper function to get the query that parses raw input of a module-backed format
+// into values, mirroring the `-I csv`/`-I tsv`/`-I json` handling of the mq CLI.
+fn module_query_prefix(input_format: InputFormat) -> Option<&'static str> {
+    match input_format {
+        InputFormat::Csv => Some(r#"import "csv" | csv::csv_parse(true)"#),
+        InputFormat::Json => Some(r#"import "json" | json::json_parse()"#),
+        InputFormat::Tsv => Some(r#"import "csv" | csv::tsv_parse(true)"#),
+        _ => None,
+    }
+}
+
+// Converts a Jupyter notebook into markdown. Markdown cells are kept as-is, and code cells
+// become fenced code blocks in the notebook's language so that `.code` selects them.
+fn notebook_to_markdown(input: &str) -> Result<String, String> {
+    let notebook: serde_json::Value = serde_json::from_str(input).map_err(|e| e.to_string())?;
+    let cells = notebook["cells"]
+        .as_array()
+        .ok_or_else(|| "missing \"cells\" array".to_string())?;
+    let language = notebook["metadata"]["language_info"]["name"]
+        .as_str()
+        .or_else(|| notebook["metadata"]["kernelspec"]["language"].as_str())
+        .unwrap_or_default();
+
+    let blocks: Vec<String> = cells
+        .iter()
+        .filter_map(|cell| {
+            let source = match &cell["source"] {
+                serde_json::Value::String(s) => s.clone(),
+                serde_json::Value::Array(lines) => lines.iter().filter_map(|line| line.as_str()).collect(),
+                _ => String::new(),
+            };
+            match cell["cell_type"].as_str() {
+                Some("markdown") => Some(source),
+                Some("code") => {
+                    // The fence must be longer than any backtick run in the cell, or the cell would close it.
+                    let longest_run = source.split(|c| c != '`').map(str::len).max().unwrap_or_default();
+                    let fence = "`".repeat((longest_run + 1).max(3));
+                    Some(format!(
+                        "{fence}{}\n{}\n{fence}",
+                        language,
+                        source.trim_end_matches('\n')
+                    ))
+                }
+                _ => None,
+            }
+        })
+        .collect();
+
+    Ok(blocks.join("\n\n"))
+}
+
 // Helper function to convert C string to Rust string slice
 unsafe fn c_str_to_rust_str_slice<'a>(s: *const c_char) -> Result<&'a str, std::str::Utf8Error> {
     if s.is_null() {
@@ -161,12 +467,112 @@ pub extern "C" fn mq_destroy(engine_ptr: *mut MqContext) {
 /// - `input_format_c` must be a valid pointer to a null-terminated C string
 /// - All string pointers must remain valid for the duration of this function call
 /// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+/// - If the engine panics, the panic is caught and reported through `error_msg`; the engine
+///   may be left in an inconsistent state and should be destroyed. This needs a library built
+///   with `panic = "unwind"` (the `release-ffi` profile); in a `--release` build a panic aborts
+///   the host process
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn mq_eval(
     engine_ptr: *mut MqContext,
     code_c: *const c_char,
     input_c: *const c_char,
     input_format_c: *const c_char, // "markdown" or "mdx" or "text"
+) -> MqResult {
+    catch_panic_result(|| unsafe {
+        eval(
+            engine_ptr,
+            code_c,
+            Input::CStr(input_c),
+            input_format_c,
+            MqEvalOptions::default(),
+        )
+    })
+}
+
+/// Evaluates mq code with input given as a pointer and byte length instead of a
+/// null-terminated string, so input containing NUL bytes is passed through intact.
+/// The input must be valid UTF-8; otherwise an error is returned rather than truncating it.
+/// Results are still returned as C strings, so if a result value contains a NUL byte the
+/// evaluation fails with an error instead of returning a truncated value.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences raw pointers. The caller must ensure:
+/// - `engine_ptr` must be a valid pointer to an `Engine` created by `mq_create`
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - `input_ptr` must be a valid pointer to `input_len` readable bytes, or null if `input_len` is 0
+/// - `input_format_c` must be a valid pointer to a null-terminated C string
+/// - All pointers must remain valid for the duration of this function call
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_eval_bytes(
+    engine_ptr: *mut MqContext,
+    code_c: *const c_char,
+    input_ptr: *const u8,
+    input_len: usize,
+    input_format_c: *const c_char,
+) -> MqResult {
+    catch_panic_result(|| unsafe {
+        eval(
+            engine_ptr,
+            code_c,
+            Input::Bytes(input_ptr, input_len),
+            input_format_c,
+            MqEvalOptions::default(),
+        )
+    })
+}
+
+/// Evaluates mq code with the given input, rendering each result as described by `options`.
+/// With `MqEvalOptions` zero-initialized this behaves exactly like `mq_eval`.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences raw pointers. The caller must ensure:
+/// - `engine_ptr` must be a valid pointer to an `Engine` created by `mq_create`
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - `input_c` must be a valid pointer to a null-terminated C string
+/// - `input_format_c` must be a valid pointer to a null-terminated C string
+/// - All string pointers must remain valid for the duration of this function call
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_eval_with_options(
+    engine_ptr: *mut MqContext,
+    code_c: *const c_char,
+    input_c: *const c_char,
+    input_format_c: *const c_char,
+    options: MqEvalOptions,
+) -> MqResult {
+    catch_panic_result(|| unsafe { eval(engine_ptr, code_c, Input::CStr(input_c), input_format_c, options) })
+}
+
+// Input passed to `eval`, either as a null-terminated C string or as a pointer and length.
+enum Input {
+    CStr(*const c_char),
+    Bytes(*const u8, usize),
+}
+
+impl Input {
+    unsafe fn to_str<'a>(self) -> Result<&'a str, &'static str> {
+        match self {
+            Input::CStr(p) if p.is_null() => Err("Input pointer is null"),
+            Input::CStr(p) => unsafe { c_str_to_rust_str_slice(p) }.map_err(|_| "Invalid UTF-8 sequence in input"),
+            Input::Bytes(_, 0) => Ok(""),
+            Input::Bytes(p, _) if p.is_null() => Err("Input pointer is null"),
+            Input::Bytes(p, len) => std::str::from_utf8(unsafe { std::slice::from_raw_parts(p, len) })
+                .map_err(|_| "Invalid UTF-8 sequence in input"),
+        }
+    }
+}
+
+unsafe fn eval(
+    engine_ptr: *mut MqContext,
+    code_c: *const c_char,
+    input: Input,
+    input_format_c: *const c_char,
+    options: MqEvalOptions,
 ) -> MqResult {
     if engine_ptr.is_null() {
         return MqResult {
@@ -188,47 +594,70 @@ pub unsafe extern "C" fn mq_eval(
         }
     };
 
-    if input_c.is_null() {
+    let input_str = match unsafe { input.to_str() } {
+        Ok(s) => s,
+        Err(msg) => {
+            return MqResult {
+                values: ptr::null_mut(),
+                values_len: 0,
+                error_msg: to_c_string(msg.to_string()),
+            };
+        }
+    };
+
+    if input_format_c.is_null() {
         return MqResult {
             values: ptr::null_mut(),
             values_len: 0,
-            error_msg: to_c_string("Input pointer is null".to_string()),
+            error_msg: to_c_string("Input format pointer is null".to_string()),
         };
     }
 
-    let input_str = match unsafe { c_str_to_rust_str_slice(input_c) } {
+    let input_format_str = match unsafe { c_str_to_rust_str_slice(input_format_c) } {
         Ok(s) => s,
         Err(_) => {
             return MqResult {
                 values: ptr::null_mut(),
                 values_len: 0,
-                error_msg: to_c_string("Invalid UTF-8 sequence in input".to_string()),
+                error_msg: to_c_string("Invalid UTF-8 sequence in input_format".to_string()),
             };
         }
     };
 
-    if input_format_c.is_null() {
+    let Some(input_format) = InputFormat::from_name(input_format_str) else {
         return MqResult {
             values: ptr::null_mut(),
             values_len: 0,
-            error_msg: to_c_string("Input format pointer is null".to_string()),
+            error_msg: to_c_string(format!(
+                "Unsupported input format: {} (expected one of: {})",
+                input_format_str.to_lowercase(),
+                INPUT_FORMATS.map(|(name, _)| name).join(", ")
+            )),
         };
-    }
+    };
 
-    let input_format_str = match unsafe { c_str_to_rust_str_slice(input_format_c) } {
-        Ok(s) => s.to_lowercase(),
-        Err(_) => {
+    let code = match module_query_prefix(input_format) {
+        Some(prefix) if code.is_empty() => prefix.to_string(),
+        Some(prefix) => format!("{} | {}", prefix, code),
+        None => code.to_string(),
+    };
+
+    // Compile before parsing the input, so an interrupt requested while the input is parsed
+    // still stops the evaluation: only `compile` discards a stale request.
+    let compiled = match engine.compile(&code) {
+        Ok(compiled) => compiled,
+        Err(e) => {
             return MqResult {
                 values: ptr::null_mut(),
                 values_len: 0,
-                error_msg: to_c_string("Invalid UTF-8 sequence in input_format".to_string()),
+                error_msg: to_c_string(format!("Error evaluating query: {}", e)),
             };
         }
     };
 
-    let mq_input_values: Vec<RuntimeValue> = match input_format_str.as_str() {
-        "text" => mq_lang::parse_text_input(input_str).unwrap(),
-        "markdown" => match mq_lang::parse_markdown_input(input_str) {
+    let mq_input_values: Vec<RuntimeValue> = match input_format {
+        InputFormat::Text => mq_lang::parse_text_input(input_str).unwrap(),
+        InputFormat::Markdown => match mq_lang::parse_markdown_input(input_str) {
             Ok(v) => v,
             Err(e) => {
                 return MqResult {
@@ -238,7 +667,7 @@ pub unsafe extern "C" fn mq_eval(
                 };
             }
         },
-        "mdx" => match mq_lang::parse_mdx_input(input_str) {
+        InputFormat::Mdx => match mq_lang::parse_mdx_input(input_str) {
             Ok(v) => v,
             Err(e) => {
                 return MqResult {
@@ -248,7 +677,7 @@ pub unsafe extern "C" fn mq_eval(
                 };
             }
         },
-        "html" => match mq_lang::parse_html_input(input_str) {
+        InputFormat::Html => match mq_lang::parse_html_input(input_str) {
             Ok(v) => v,
             Err(e) => {
                 return MqResult {
@@ -258,32 +687,49 @@ pub unsafe extern "C" fn mq_eval(
                 };
             }
         },
-        _ => {
-            return MqResult {
-                values: ptr::null_mut(),
-                values_len: 0,
-                error_msg: to_c_string(format!("Unsupported input format: {}", input_format_str)),
-            };
-        }
+        InputFormat::Ipynb => match notebook_to_markdown(input_str)
+            .and_then(|markdown| mq_lang::parse_markdown_input(&markdown).map_err(|e| e.to_string()))
+        {
+            Ok(v) => v,
+            Err(e) => {
+                return MqResult {
+                    values: ptr::null_mut(),
+                    values_len: 0,
+                    error_msg: to_c_string(format!("Notebook parsing error: {}", e)),
+                };
+            }
+        },
+        InputFormat::Csv | InputFormat::Json | InputFormat::Tsv => mq_lang::raw_input(input_str),
     };
 
-    match engine.eval(code, mq_input_values.into_iter()) {
-        Ok(result_values) => {
-            let mut c_values: Vec<*mut c_char> = Vec::new();
-            let values_len = result_values.len();
+    let result = if code.is_empty() {
+        Ok(vec![].into())
+    } else {
+        engine.eval_compiled(&compiled, mq_input_values.into_iter())
+    };
 
-            for value in result_values {
-                // For now, convert all values to their string representation.
-                // More sophisticated type handling could be added later.
-                c_values.push(to_c_string(value.to_string()));
+    match result {
+        Ok(result_values) => {
+            let rendered: Vec<String> = result_values.iter().map(|value| render_value(value, options)).collect();
+            // A C string ends at the first NUL, so such a value cannot be returned without losing data.
+            if rendered.iter().any(|value| value.contains('\0')) {
+                return MqResult {
+                    values: ptr::null_mut(),
+                    values_len: 0,
+                    error_msg: to_c_string(
+                        "Result value contains a NUL byte and cannot be returned as a C string".to_string(),
+                    ),
+                };
             }
 
+            // A boxed slice has capacity equal to its length, which `mq_free_result` relies on.
+            let c_values: Box<[*mut c_char]> = rendered.into_iter().map(to_c_string).collect();
+            let values_len = c_values.len();
+
             let ptr = if c_values.is_empty() {
                 ptr::null_mut()
             } else {
-                let p = c_values.as_mut_ptr();
-                std::mem::forget(c_values); // Prevent Rust from freeing the Vec's memory
-                p
+                Box::into_raw(c_values) as *mut *mut c_char
             };
 
             MqResult {
@@ -300,6 +746,22 @@ pub unsafe extern "C" fn mq_eval(
     }
 }
 
+/// Returns whether `input_format_c` names an input format accepted by `mq_eval`
+/// (case-insensitive), so callers can reject a misspelled format before evaluating.
+/// Returns false if `input_format_c` is null or not valid UTF-8.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+/// - `input_format_c` must be a valid pointer to a null-terminated C string, or null
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_is_supported_input_format(input_format_c: *const c_char) -> bool {
+    if input_format_c.is_null() {
+        return false;
+    }
+    unsafe { c_str_to_rust_str_slice(input_format_c) }.is_ok_and(|s| InputFormat::from_name(s).is_some())
+}
+
 /// Frees a C string allocated by Rust.
 ///
 /// # Safety
@@ -331,16 +793,16 @@ pub extern "C" fn mq_free_result(result: MqResult) {
 
     if !result.values.is_null() {
         unsafe {
-            // Reconstruct the Vec from the raw parts to properly deallocate it
-            // along with its elements.
-            let values_vec = Vec::from_raw_parts(result.values, result.values_len, result.values_len);
-            for value_ptr in values_vec {
+            // Every entry point hands out `values` as a leaked `Box<[*mut c_char]>`, so rebuild
+            // the same boxed slice to deallocate it along with its elements.
+            let values = Box::from_raw(ptr::slice_from_raw_parts_mut(result.values, result.values_len));
+            for &value_ptr in values.iter() {
                 if !value_ptr.is_null() {
                     // This was already a CString, so free it with mq_free_string
                     mq_free_string(value_ptr);
                 }
             }
-            // The Vec itself is dropped here, freeing the memory it owned for the pointers.
+            // The boxed slice itself is dropped here, freeing the memory it owned for the pointers.
         }
     }
 }
@@ -395,43 +857,60 @@ pub unsafe extern "C" fn mq_html_to_markdown(
         }
     }
 
-    // Validate input pointer
-    if html_input_c.is_null() {
-        if !error_msg.is_null() {
-            unsafe {
-                *error_msg = to_c_string("HTML input pointer is null".to_string());
-            }
+    catch_panic_c_string(unsafe { error_msg.as_mut() }, || {
+        if html_input_c.is_null() {
+            return Err("HTML input pointer is null".to_string());
         }
-        return ptr::null_mut();
-    }
+        let html_input_str = unsafe { c_str_to_rust_str_slice(html_input_c) }
+            .map_err(|_| "Invalid UTF-8 sequence in HTML input".to_string())?;
 
-    // Convert C string to Rust string
-    let html_input_str = match unsafe { c_str_to_rust_str_slice(html_input_c) } {
-        Ok(s) => s,
-        Err(_) => {
-            if !error_msg.is_null() {
-                unsafe {
-                    *error_msg = to_c_string("Invalid UTF-8 sequence in HTML input".to_string());
-                }
-            }
-            return ptr::null_mut();
-        }
-    };
+        convert_html_to_markdown(html_input_str, options.into())
+            .map_err(|e| format!("HTML to Markdown conversion error: {}", e))
+    })
+}
 
-    // Convert options and call the conversion function
-    let rust_options: ConversionOptions = options.into();
-    match convert_html_to_markdown(html_input_str, rust_options) {
-        Ok(markdown) => to_c_string(markdown),
-        Err(e) => {
-            if !error_msg.is_null() {
-                unsafe {
-                    *error_msg = to_c_string(format!("HTML to Markdown conversion error: {}", e));
-                }
-            }
-            ptr::null_mut()
+/// Converts a JSON AST, as returned by the `Json` output format, back to Markdown.
+/// The input must be a JSON array of nodes or a single node object.
+/// Returns a C string containing the markdown output, or NULL on error.
+/// The caller is responsible for freeing the result using `mq_free_string`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences raw pointers. The caller must ensure:
+/// - `json_input_c` must be a valid pointer to a null-terminated C string
+/// - `error_msg` must be a valid pointer to a location where an error message pointer can be stored
+/// - The string pointer must remain valid for the duration of this function call
+/// - The returned C string must be freed using `mq_free_string` to avoid memory leaks
+/// - If an error occurs, the function returns NULL and sets `*error_msg` to an error message
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_json_to_markdown(json_input_c: *const c_char, error_msg: *mut *mut c_char) -> *mut c_char {
+    if !error_msg.is_null() {
+        unsafe {
+            *error_msg = ptr::null_mut();
         }
     }
+
+    catch_panic_c_string(unsafe { error_msg.as_mut() }, || {
+        if json_input_c.is_null() {
+            return Err("JSON input pointer is null".to_string());
+        }
+        let json_input_str = unsafe { c_str_to_rust_str_slice(json_input_c) }
+            .map_err(|_| "Invalid UTF-8 sequence in JSON input".to_string())?
+            .trim_start();
+
+        // A single node, as returned per result by `mq_eval_with_options`, is accepted as-is.
+        let json_nodes = if json_input_str.starts_with('{') {
+            format!("[{}]", json_input_str)
+        } else {
+            json_input_str.to_string()
+        };
+
+        Markdown::from_json(&json_nodes)
+            .map(|markdown| markdown.to_string())
+            .map_err(|e| format!("JSON to Markdown conversion error: {}", e))
+    })
 }
+
 /// Returns the mq-ffi library version as a static, null-terminated string.
 #[unsafe(no_mangle)]
 pub extern "C" fn mq_version() -> *const c_char {
@@ -479,6 +958,61 @@ pub extern "C" fn mq_set_max_call_stack_depth(engine_ptr: *mut MqContext, max_ca
     engine.set_max_call_stack_depth(max_call_stack_depth);
 }
 
+/// Enables or disables sandbox mode on this engine for evaluating untrusted mq code.
+///
+/// While enabled, the network (`http`) and filesystem (`read_file`, `read_file_bytes`,
+/// `collection`, `file_exists`, `write_file`) builtins and `$NAME` environment variable
+/// references are all rejected, and modules can only be loaded from the standard library
+/// (such as `csv` or `json`): neither the search paths nor HTTP imports are consulted,
+/// including the default `$HOME/.mq` and current directory paths. Modules imported with
+/// `mq_import_module` before enabling the sandbox stay available. Only this engine is
+/// affected; other engines in the process keep their settings.
+/// Has no effect if `engine_ptr` is null.
+#[unsafe(no_mangle)]
+pub extern "C" fn mq_set_sandbox(engine_ptr: *mut MqContext, enabled: bool) {
+    if engine_ptr.is_null() {
+        return;
+    }
+    let engine = unsafe { &mut *(engine_ptr as *mut Engine) };
+    engine.set_sandbox(enabled);
+}
+
+/// Returns a handle that stops the engine's running `mq_eval` call when passed to
+/// `mq_interrupt`, which may be called from any thread.
+/// The caller is responsible for freeing the handle using `mq_free_interrupt_handle`.
+/// Returns NULL if `engine_ptr` is null.
+#[unsafe(no_mangle)]
+pub extern "C" fn mq_interrupt_handle(engine_ptr: *mut MqContext) -> *mut MqInterruptHandle {
+    if engine_ptr.is_null() {
+        return ptr::null_mut();
+    }
+    let engine = unsafe { &*(engine_ptr as *mut Engine) };
+    Box::into_raw(Box::new(engine.interrupt_handle())) as *mut MqInterruptHandle
+}
+
+/// Stops the `mq_eval` call currently running on the handle's engine, which then returns
+/// an "Execution was interrupted" error. Unlike the engine itself, the handle may be used
+/// from a different thread than the one evaluating. Has no effect if `handle_ptr` is null.
+#[unsafe(no_mangle)]
+pub extern "C" fn mq_interrupt(handle_ptr: *mut MqInterruptHandle) {
+    if handle_ptr.is_null() {
+        return;
+    }
+    let handle = unsafe { &*(handle_ptr as *mut InterruptHandle) };
+    handle.interrupt();
+}
+
+/// Frees a handle returned by `mq_interrupt_handle`. The handle may outlive its engine.
+#[unsafe(no_mangle)]
+pub extern "C" fn mq_free_interrupt_handle(handle_ptr: *mut MqInterruptHandle) {
+    if handle_ptr.is_null() {
+        return;
+    }
+    unsafe {
+        let _ = Box::from_raw(handle_ptr as *mut InterruptHandle);
+    }
+}
+
 /// Sets the search paths used to resolve modules loaded via `mq_import_module`
 /// or `mq_load_module`. Has no effect if `engine_ptr` is null.
 ///
@@ -560,9 +1094,10 @@ pub unsafe extern "C" fn mq_import_module(engine_ptr: *mut MqContext, module_nam
         Err(_) => return to_c_string("Invalid UTF-8 sequence in module_name".to_string()),
     };
 
-    match engine.import_module(module_name) {
-        Ok(()) => ptr::null_mut(),
-        Err(e) => to_c_string(format!("Error importing module: {}", e)),
+    match catch_panic(|| engine.import_module(module_name)) {
+        Ok(Ok(())) => ptr::null_mut(),
+        Ok(Err(e)) => to_c_string(format!("Error importing module: {}", e)),
+        Err(msg) => to_c_string(msg),
     }
 }
 
@@ -588,9 +1123,10 @@ pub unsafe extern "C" fn mq_load_module(engine_ptr: *mut MqContext, module_name_
         Err(_) => return to_c_string("Invalid UTF-8 sequence in module_name".to_string()),
     };
 
-    match engine.load_module(module_name) {
-        Ok(()) => ptr::null_mut(),
-        Err(e) => to_c_string(format!("Error loading module: {}", e)),
+    match catch_panic(|| engine.load_module(module_name)) {
+        Ok(Ok(())) => ptr::null_mut(),
+        Ok(Err(e)) => to_c_string(format!("Error loading module: {}", e)),
+        Err(msg) => to_c_string(msg),
     }
 }
 
@@ -669,16 +1205,469 @@ pub extern "C" fn mq_clear_http_cache_all(engine_ptr: *mut MqContext) -> *mut c_
     }
 }
 
-#[cfg(test)]
-mod tests {
-    use super::*;
-
-    // Helper function to create a C string for testing
-    fn make_c_string(s: &str) -> *const c_char {
-        CString::new(s).unwrap().into_raw()
+// Helper function to get the highlighting category of a token kind.
+fn token_category(kind: &TokenKind) -> &'static str {
+    match kind {
+        TokenKind::As
+        | TokenKind::Break
+        | TokenKind::Catch
+        | TokenKind::Continue
+        | TokenKind::Def
+        | TokenKind::Do
+        | TokenKind::Elif
+        | TokenKind::Else
+        | TokenKind::End
+        | TokenKind::Fn
+        | TokenKind::Foreach
+        | TokenKind::If
+        | TokenKind::Import
+        | TokenKind::Include
+        | TokenKind::Let
+        | TokenKind::Loop
+        | TokenKind::Macro
+        | TokenKind::Match
+        | TokenKind::Module
+        | TokenKind::Nodes
+        | TokenKind::None
+        | TokenKind::Quote
+        | TokenKind::Self_
+        | TokenKind::Try
+        | TokenKind::Unquote
+        | TokenKind::Var
+        | TokenKind::While => "keyword",
+        TokenKind::BoolLiteral(_) => "boolean",
+        TokenKind::NumberLiteral(_) => "number",
+        TokenKind::StringLiteral(_) | TokenKind::InterpolatedString(_) | TokenKind::BytesLiteral(_) => "string",
+        TokenKind::Comment(_) => "comment",
+        TokenKind::Selector(_) => "selector",
+        TokenKind::Ident(_) => "ident",
+        TokenKind::Env(_) => "env",
+        TokenKind::Colon
+        | TokenKind::DoubleColon
+        | TokenKind::Comma
+        | TokenKind::SemiColon
+        | TokenKind::LParen
+        | TokenKind::RParen
+        | TokenKind::LBrace
+        | TokenKind::RBrace
+        | TokenKind::LBracket
+        | TokenKind::RBracket => "punctuation",
+        _ => "operator",
     }
+}
 
-    // Helper function to convert C string back to Rust string for assertions
+/// Tokenizes mq code for syntax highlighting, tolerating incomplete or invalid code.
+/// Each value in the result is one token encoded as a JSON object with `kind` ("keyword",
+/// "boolean", "number", "string", "comment", "selector", "ident", "env", "punctuation" or
+/// "operator") and `range` (1-based `line` and `column` of `start` and `end`) fields.
+/// Whitespace is not included.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_tokenize(code_c: *const c_char) -> MqResult {
+    catch_panic_result(|| {
+        let code = match unsafe { c_str_to_rust_str_slice(code_c) } {
+            Ok(s) => s,
+            Err(_) => {
+                return MqResult {
+                    values: ptr::null_mut(),
+                    values_len: 0,
+                    error_msg: to_c_string("Invalid UTF-8 sequence in code".to_string()),
+                };
+            }
+        };
+
+        let c_values: Box<[*mut c_char]> = mq_lang::tokenize(code)
+            .iter()
+            .map(|token| {
+                to_c_string(
+                    serde_json::json!({
+                        "kind": token_category(&token.kind),
+                        "range": {
+                            "start": {"line": token.range.start.line, "column": token.range.start.column},
+                            "end": {"line": token.range.end.line, "column": token.range.end.column},
+                        },
+                    })
+                    .to_string(),
+                )
+            })
+            .collect();
+        let values_len = c_values.len();
+
+        MqResult {
+            values: if c_values.is_empty() {
+                ptr::null_mut()
+            } else {
+                Box::into_raw(c_values) as *mut *mut c_char
+            },
+            values_len,
+            error_msg: ptr::null_mut(),
+        }
+    })
+}
+
+/// Parses mq code without evaluating it and returns its abstract syntax tree as a single
+/// JSON value, so callers can inspect which selectors and functions a query uses (for
+/// example to validate an expensive query) before running it. The JSON format is the one
+/// produced by `mq_lang::ast_to_json`. Requires the `ast-json` feature; otherwise an error
+/// is returned.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_parse_ast(code_c: *const c_char) -> MqResult {
+    catch_panic_result(|| {
+        #[cfg(feature = "ast-json")]
+        {
+            let code = match unsafe { c_str_to_rust_str_slice(code_c) } {
+                Ok(s) => s,
+                Err(_) => {
+                    return MqResult {
+                        values: ptr::null_mut(),
+                        values_len: 0,
+                        error_msg: to_c_string("Invalid UTF-8 sequence in code".to_string()),
+                    };
+                }
+            };
+
+            let token_arena = mq_lang::Shared::new(mq_lang::SharedCell::new(mq_lang::Arena::new(1024)));
+            let ast_json = mq_lang::parse(code, token_arena)
+                .map_err(|e| format!("Error parsing query: {}", e))
+                .and_then(|program| mq_lang::ast_to_json(&program).map_err(|e| e.to_string()));
+
+            match ast_json {
+                Ok(ast_json) => {
+                    let c_values: Box<[*mut c_char]> = Box::new([to_c_string(ast_json)]);
+                    MqResult {
+                        values: Box::into_raw(c_values) as *mut *mut c_char,
+                        values_len: 1,
+                        error_msg: ptr::null_mut(),
+                    }
+                }
+                Err(e) => MqResult {
+                    values: ptr::null_mut(),
+                    values_len: 0,
+                    error_msg: to_c_string(e),
+                },
+            }
+        }
+        #[cfg(not(feature = "ast-json"))]
+        {
+            let _ = code_c;
+            MqResult {
+                values: ptr::null_mut(),
+                values_len: 0,
+                error_msg: to_c_string("This library was built without the ast-json feature".to_string()),
+            }
+        }
+    })
+}
+
+/// Lints mq code without evaluating it, using the default rule set of the mq linter.
+/// Each value in the result is one finding encoded as a JSON object with `rule`,
+/// `severity` ("style", "perf", "warn" or "error"), `message`, `help`, and `range`
+/// (1-based `line` and `column` of `start` and `end`, or null) fields.
+/// Requires the `lint` feature; otherwise an error is returned.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_lint(code_c: *const c_char) -> MqResult {
+    catch_panic_result(|| {
+        #[cfg(feature = "lint")]
+        {
+            let code = match unsafe { c_str_to_rust_str_slice(code_c) } {
+                Ok(s) => s,
+                Err(_) => {
+                    return MqResult {
+                        values: ptr::null_mut(),
+                        values_len: 0,
+                        error_msg: to_c_string("Invalid UTF-8 sequence in code".to_string()),
+                    };
+                }
+            };
+
+            let mut hir = mq_hir::Hir::default();
+            let (source_id, _) = hir.add_code(None, code);
+            let config = mq_lint::LintConfig::default();
+            let ctx = mq_lint::LintContext::new(&hir, source_id, &config);
+
+            let c_values: Box<[*mut c_char]> = mq_lint::Linter::with_default_rules()
+                .run(&ctx)
+                .iter()
+                .map(|diagnostic| {
+                    let range = diagnostic.range.map(|range| {
+                        serde_json::json!({
+                            "start": {"line": range.start.line, "column": range.start.column},
+                            "end": {"line": range.end.line, "column": range.end.column},
+                        })
+                    });
+                    to_c_string(
+                        serde_json::json!({
+                            "rule": diagnostic.rule_id().as_str(),
+                            "severity": diagnostic.severity.to_string(),
+                            "message": diagnostic.message(),
+                            "help": diagnostic.help(),
+                            "range": range,
+                        })
+                        .to_string(),
+                    )
+                })
+                .collect();
+            let values_len = c_values.len();
+
+            MqResult {
+                values: if c_values.is_empty() {
+                    ptr::null_mut()
+                } else {
+                    Box::into_raw(c_values) as *mut *mut c_char
+                },
+                values_len,
+                error_msg: ptr::null_mut(),
+            }
+        }
+        #[cfg(not(feature = "lint"))]
+        {
+            let _ = code_c;
+            MqResult {
+                values: ptr::null_mut(),
+                values_len: 0,
+                error_msg: to_c_string("This library was built without the lint feature".to_string()),
+            }
+        }
+    })
+}
+
+/// Lists the functions defined in mq code without evaluating it, for generating reference
+/// documentation from a script library. Each value in the result is one function encoded
+/// as a JSON object with `name`, `params`, `doc` (the `#` comment lines above the
+/// definition, joined by newlines), and `range` fields, in source order.
+/// Only named functions outside any other function are listed: lambdas (`fn(x): ...;`) and
+/// `def`s nested inside another function body are implementation details and are omitted.
+/// Requires the `analysis` feature; otherwise an error is returned.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_defined_functions(code_c: *const c_char) -> MqResult {
+    catch_panic_result(|| {
+        #[cfg(feature = "analysis")]
+        {
+            let code = match unsafe { c_str_to_rust_str_slice(code_c) } {
+                Ok(s) => s,
+                Err(_) => {
+                    return MqResult {
+                        values: ptr::null_mut(),
+                        values_len: 0,
+                        error_msg: to_c_string("Invalid UTF-8 sequence in code".to_string()),
+                    };
+                }
+            };
+
+            let mut hir = mq_hir::Hir::default();
+            let (source_id, _) = hir.add_code(None, code);
+
+            let mut functions = hir
+                .symbols()
+                .filter(|(_, symbol)| symbol.source.source_id == Some(source_id) && symbol.value.is_some())
+                .filter(|(_, symbol)| !is_inside_function(&hir, symbol))
+                .filter_map(|(_, symbol)| match &symbol.kind {
+                    mq_hir::SymbolKind::Function(params) => Some((symbol, params)),
+                    _ => None,
+                })
+                .collect::<Vec<_>>();
+            functions.sort_by_key(|(symbol, _)| symbol.source.text_range);
+
+            let c_values: Box<[*mut c_char]> = functions
+                .iter()
+                .map(|(symbol, params)| {
+                    let range = symbol.source.text_range.map(|range| {
+                        serde_json::json!({
+                            "start": {"line": range.start.line, "column": range.start.column},
+                            "end": {"line": range.end.line, "column": range.end.column},
+                        })
+                    });
+                    to_c_string(
+                        serde_json::json!({
+                            "name": symbol.value.as_deref().unwrap_or_default(),
+                            "params": params.iter().map(|param| param.to_string()).collect::<Vec<_>>(),
+                            "doc": symbol_doc(symbol),
+                            "range": range,
+                        })
+                        .to_string(),
+                    )
+                })
+                .collect();
+            let values_len = c_values.len();
+
+            MqResult {
+                values: if c_values.is_empty() {
+                    ptr::null_mut()
+                } else {
+                    Box::into_raw(c_values) as *mut *mut c_char
+                },
+                values_len,
+                error_msg: ptr::null_mut(),
+            }
+        }
+        #[cfg(not(feature = "analysis"))]
+        {
+            let _ = code_c;
+            MqResult {
+                values: ptr::null_mut(),
+                values_len: 0,
+                error_msg: to_c_string("This library was built without the analysis feature".to_string()),
+            }
+        }
+    })
+}
+
+/// Returns the `#` comment lines documenting `symbol`, joined by newlines, with the space
+/// after each `#` removed.
+#[cfg(feature = "analysis")]
+fn symbol_doc(symbol: &mq_hir::Symbol) -> String {
+    symbol
+        .doc
+        .iter()
+        .map(|(_, line)| line.strip_prefix(' ').unwrap_or(line))
+        .collect::<Vec<_>>()
+        .join("\n")
+}
+
+/// Returns true if `symbol` is defined within the body of a function or lambda.
+#[cfg(feature = "analysis")]
+fn is_inside_function(hir: &mq_hir::Hir, symbol: &mq_hir::Symbol) -> bool {
+    let mut parent = symbol.parent;
+    while let Some(parent_symbol) = parent.and_then(|id| hir.symbol(id)) {
+        if matches!(parent_symbol.kind, mq_hir::SymbolKind::Function(_)) {
+            return true;
+        }
+        parent = parent_symbol.parent;
+    }
+    false
+}
+
+/// Returns completion candidates for the cursor at `line` and `column` (1-based) in mq code:
+/// functions, macros, variables, and parameters in scope there, followed by builtin
+/// functions and selectors, without duplicates. Each value in the result is one candidate
+/// encoded as a JSON object with `label`, `kind` ("function", "variable" or "selector"),
+/// `params` (null unless a function), `doc`, and `deprecated` fields.
+/// Requires the `analysis` feature; otherwise an error is returned.
+/// The caller is responsible for freeing the result using `mq_free_result`.
+///
+/// # Safety
+///
+/// This function is unsafe because it dereferences a raw pointer. The caller must ensure:
+/// - `code_c` must be a valid pointer to a null-terminated C string
+/// - The returned `MqResult` must be freed using `mq_free_result` to avoid memory leaks
+#[unsafe(no_mangle)]
+pub unsafe extern "C" fn mq_complete(code_c: *const c_char, line: u32, column: u32) -> MqResult {
+    catch_panic_result(|| {
+        #[cfg(feature = "analysis")]
+        {
+            let code = match unsafe { c_str_to_rust_str_slice(code_c) } {
+                Ok(s) => s,
+                Err(_) => {
+                    return MqResult {
+                        values: ptr::null_mut(),
+                        values_len: 0,
+                        error_msg: to_c_string("Invalid UTF-8 sequence in code".to_string()),
+                    };
+                }
+            };
+
+            let mut hir = mq_hir::Hir::default();
+            let (source_id, _) = hir.add_code(None, code);
+            let scope_id = hir
+                .find_scope_in_position(source_id, mq_lang::Position::new(line, column as usize))
+                .map(|(scope_id, _)| scope_id)
+                .unwrap_or_else(|| hir.find_scope_by_source(&source_id));
+
+            let mut seen = std::collections::HashSet::new();
+            let c_values: Box<[*mut c_char]> = hir
+                .find_symbols_in_scope(scope_id)
+                .into_iter()
+                .chain(hir.find_symbols_in_source(hir.builtin.source_id))
+                .filter_map(|symbol| {
+                    let (kind, params) = match &symbol.kind {
+                        mq_hir::SymbolKind::Function(params) | mq_hir::SymbolKind::Macro(params) => (
+                            "function",
+                            Some(params.iter().map(|param| param.to_string()).collect::<Vec<_>>()),
+                        ),
+                        mq_hir::SymbolKind::Parameter
+                        | mq_hir::SymbolKind::Variable
+                        | mq_hir::SymbolKind::DestructuringBinding
+                        | mq_hir::SymbolKind::PatternVariable { .. } => ("variable", None),
+                        mq_hir::SymbolKind::Selector(_) => ("selector", None),
+                        _ => return None,
+                    };
+                    let label = symbol.value.clone()?;
+                    if !seen.insert(label.clone()) {
+                        return None;
+                    }
+                    Some(to_c_string(
+                        serde_json::json!({
+                            "label": label.as_str(),
+                            "kind": kind,
+                            "params": params,
+                            "doc": symbol_doc(&symbol),
+                            "deprecated": symbol.is_deprecated(),
+                        })
+                        .to_string(),
+                    ))
+                })
+                .collect();
+            let values_len = c_values.len();
+
+            MqResult {
+                values: if c_values.is_empty() {
+                    ptr::null_mut()
+                } else {
+                    Box::into_raw(c_values) as *mut *mut c_char
+                },
+                values_len,
+                error_msg: ptr::null_mut(),
+            }
+        }
+        #[cfg(not(feature = "analysis"))]
+        {
+            let _ = (code_c, line, column);
+            MqResult {
+                values: ptr::null_mut(),
+                values_len: 0,
+                error_msg: to_c_string("This library was built without the analysis feature".to_string()),
+            }
+        }
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    // Helper function to create a C string for testing
+    fn make_c_string(s: &str) -> *const c_char {
+        CString::new(s).unwrap().into_raw()
+    }
+
+    // Helper function to convert C string back to Rust string for assertions
     unsafe fn c_string_to_rust_string(ptr: *mut c_char) -> String {
         if ptr.is_null() {
             return String::new();
@@ -811,7 +1800,7 @@ mod tests {
         let engine = mq_create();
         let code = make_c_string(".h");
         let input = make_c_string("test");
-        let format = make_c_string("json");
+        let format = make_c_string("unknown");
 
         let result = unsafe { mq_eval(engine, code, input, format) };
 
@@ -820,11 +1809,562 @@ mod tests {
         assert!(!result.error_msg.is_null());
 
         let error_msg = unsafe { c_string_to_rust_string(result.error_msg) };
-        assert!(error_msg.contains("Unsupported input format: json"));
+        assert!(error_msg.contains("Unsupported input format: unknown"));
+
+        mq_free_result(result);
+        mq_destroy(engine);
+
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_null_parameters() {
+        let engine = mq_create();
+
+        // Test with null code
+        let result = unsafe { mq_eval(engine, ptr::null(), make_c_string("test"), make_c_string("text")) };
+        assert!(result.error_msg.is_null());
+        mq_free_result(result);
+
+        // Test with null input
+        let result = unsafe { mq_eval(engine, make_c_string(".a"), ptr::null(), make_c_string("text")) };
+        assert!(!result.error_msg.is_null());
+        mq_free_result(result);
+
+        // Test with null format
+        let result = unsafe { mq_eval(engine, make_c_string(".a"), make_c_string("test"), ptr::null()) };
+        assert!(!result.error_msg.is_null());
+        mq_free_result(result);
+
+        mq_destroy(engine);
+    }
+
+    #[test]
+    fn test_eval_bytes_keeps_embedded_nul() {
+        let engine = mq_create();
+        let code = make_c_string("len()");
+        let format = make_c_string("text");
+        let input = b"before\0after";
+
+        let result = unsafe { mq_eval_bytes(engine, code, input.as_ptr(), input.len(), format) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 1);
+        unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            assert_eq!(c_string_to_rust_string(values_slice[0]), "12");
+        }
+        mq_free_result(result);
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_bytes_rejects_nul_in_result() {
+        let engine = mq_create();
+        let code = make_c_string("self");
+        let format = make_c_string("text");
+        let input = b"before\0after";
+
+        let result = unsafe { mq_eval_bytes(engine, code, input.as_ptr(), input.len(), format) };
+        assert!(result.values.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "Result value contains a NUL byte and cannot be returned as a C string"
+        );
+        mq_free_result(result);
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_bytes_rejects_invalid_utf8() {
+        let engine = mq_create();
+        let code = make_c_string("self");
+        let format = make_c_string("text");
+        let input = [b'a', 0xff, b'b'];
+
+        let result = unsafe { mq_eval_bytes(engine, code, input.as_ptr(), input.len(), format) };
+        assert!(result.values.is_null());
+        let error_msg = unsafe { c_string_to_rust_string(result.error_msg) };
+        assert_eq!(error_msg, "Invalid UTF-8 sequence in input");
+        mq_free_result(result);
+
+        // An empty input may be passed as a null pointer.
+        let result = unsafe { mq_eval_bytes(engine, code, ptr::null(), 0, format) };
+        assert!(result.error_msg.is_null());
+        mq_free_result(result);
+
+        let result = unsafe { mq_eval_bytes(engine, code, ptr::null(), 1, format) };
+        let error_msg = unsafe { c_string_to_rust_string(result.error_msg) };
+        assert_eq!(error_msg, "Input pointer is null");
+        mq_free_result(result);
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_is_supported_input_format() {
+        for (format, expected) in [
+            ("markdown", true),
+            ("MDX", true),
+            ("Html", true),
+            ("text", true),
+            ("IPYNB", true),
+            ("markdwon", false),
+            ("", false),
+        ] {
+            let format_c = make_c_string(format);
+            assert_eq!(unsafe { mq_is_supported_input_format(format_c) }, expected, "{format}");
+            unsafe { mq_free_string(format_c as *mut c_char) };
+        }
+
+        assert!(!unsafe { mq_is_supported_input_format(ptr::null()) });
+    }
+
+    #[test]
+    fn test_eval_with_csv_and_tsv_input() {
+        let engine = mq_create();
+        let code = make_c_string(r#"map(fn(row): row["name"];) | join(",")"#);
+
+        for (format, input) in [
+            ("csv", "name,age\nAlice,30\nBob,25\n"),
+            ("TSV", "name\tage\nAlice\t30\nBob\t25\n"),
+        ] {
+            let input_c = make_c_string(input);
+            let format_c = make_c_string(format);
+            let result = unsafe { mq_eval(engine, code, input_c, format_c) };
+
+            assert!(result.error_msg.is_null(), "{format}: {}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert_eq!(result.values_len, 1);
+            unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                assert_eq!(c_string_to_rust_string(values_slice[0]), "Alice,Bob");
+            }
+
+            mq_free_result(result);
+            unsafe {
+                mq_free_string(input_c as *mut c_char);
+                mq_free_string(format_c as *mut c_char);
+            }
+        }
+
+        mq_destroy(engine);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    fn test_eval_with_json_input() {
+        let engine = mq_create();
+        let code = make_c_string(r#"self["docs"] | map(fn(doc): doc["title"];) | join(",")"#);
+        let input = make_c_string(r#"{"docs": [{"title": "Intro"}, {"title": "Usage"}]}"#);
+        let format = make_c_string("json");
+
+        let result = unsafe { mq_eval(engine, code, input, format) };
+        assert!(result.error_msg.is_null(), "{}", unsafe {
+            c_string_to_rust_string(result.error_msg)
+        });
+        assert_eq!(result.values_len, 1);
+        unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            assert_eq!(c_string_to_rust_string(values_slice[0]), "Intro,Usage");
+        }
+
+        mq_free_result(result);
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_ipynb_input() {
+        let engine = mq_create();
+        let input = make_c_string(
+            r##"{
+                "metadata": {"language_info": {"name": "python"}},
+                "cells": [
+                    {"cell_type": "markdown", "source": ["# Title\n", "\n", "Some text."]},
+                    {"cell_type": "code", "source": "print(1)\n", "outputs": []},
+                    {"cell_type": "raw", "source": "ignored"}
+                ]
+            }"##,
+        );
+        let format = make_c_string("ipynb");
+
+        for (code, expected) in [
+            (".h", vec!["# Title"]),
+            (".code", vec!["```python\nprint(1)\n```"]),
+            (".code.lang", vec!["python"]),
+        ] {
+            let code_c = make_c_string(code);
+            let result = unsafe { mq_eval(engine, code_c, input, format) };
+            assert!(result.error_msg.is_null(), "{code}: {}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            // Non-matching nodes evaluate to None, which renders as an empty string.
+            let values: Vec<String> = unsafe {
+                std::slice::from_raw_parts(result.values, result.values_len)
+                    .iter()
+                    .map(|&value| c_string_to_rust_string(value))
+                    .filter(|value| !value.is_empty())
+                    .collect()
+            };
+            assert_eq!(values, expected, "{code}");
+
+            mq_free_result(result);
+            unsafe { mq_free_string(code_c as *mut c_char) };
+        }
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_ipynb_code_cell_containing_fence() {
+        let engine = mq_create();
+        let input = make_c_string(
+            r##"{
+                "metadata": {"language_info": {"name": "python"}},
+                "cells": [
+                    {"cell_type": "code", "source": ["s = \"\"\"\n", "```\n", "inner\n", "```\n", "\"\"\""]},
+                    {"cell_type": "markdown", "source": "# After"}
+                ]
+            }"##,
+        );
+        let format = make_c_string("ipynb");
+
+        for (code, expected) in [
+            (".code.value", vec!["s = \"\"\"\n```\ninner\n```\n\"\"\""]),
+            (".h", vec!["# After"]),
+        ] {
+            let code_c = make_c_string(code);
+            let result = unsafe { mq_eval(engine, code_c, input, format) };
+            assert!(result.error_msg.is_null(), "{code}: {}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            // Non-matching nodes evaluate to None, which renders as an empty string.
+            let values: Vec<String> = unsafe {
+                std::slice::from_raw_parts(result.values, result.values_len)
+                    .iter()
+                    .map(|&value| c_string_to_rust_string(value))
+                    .filter(|value| !value.is_empty())
+                    .collect()
+            };
+            assert_eq!(values, expected, "{code}");
+
+            mq_free_result(result);
+            unsafe { mq_free_string(code_c as *mut c_char) };
+        }
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_invalid_ipynb_input() {
+        let engine = mq_create();
+        let code = make_c_string(".h");
+        let input = make_c_string(r#"{"nbformat": 4}"#);
+        let format = make_c_string("ipynb");
+
+        let result = unsafe { mq_eval(engine, code, input, format) };
+        assert!(result.values.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "Notebook parsing error: missing \"cells\" array"
+        );
+
+        mq_free_result(result);
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_options_output_format() {
+        let engine = mq_create();
+        let code = make_c_string(".h");
+        let input = make_c_string("# **Header**\n");
+        let format = make_c_string("markdown");
+
+        for (output_format, expected) in [
+            (MqOutputFormat::Markdown, "# **Header**"),
+            (MqOutputFormat::Html, "<h1><strong>Header</strong></h1>"),
+            (MqOutputFormat::Text, "Header"),
+        ] {
+            let options = MqEvalOptions {
+                output_format,
+                ..Default::default()
+            };
+            let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+            assert!(result.error_msg.is_null(), "{}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert_eq!(result.values_len, 1);
+            unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                assert_eq!(c_string_to_rust_string(values_slice[0]).trim(), expected);
+            }
+            mq_free_result(result);
+        }
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_options_text_output_uses_visible_text() {
+        let engine = mq_create();
+        let code = make_c_string(".[]");
+        let input = make_c_string(
+            "- see [the *docs*](https://example.com)\n- ![a logo](logo.png)\n- before <b>bold</b> after\n",
+        );
+        let format = make_c_string("markdown");
+        let options = MqEvalOptions {
+            output_format: MqOutputFormat::Text,
+            ..Default::default()
+        };
+
+        let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+        assert!(result.error_msg.is_null(), "{}", unsafe {
+            c_string_to_rust_string(result.error_msg)
+        });
+        assert_eq!(result.values_len, 3);
+        unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            assert_eq!(c_string_to_rust_string(values_slice[0]), "see the docs");
+            assert_eq!(c_string_to_rust_string(values_slice[1]), "a logo");
+            assert_eq!(c_string_to_rust_string(values_slice[2]), "before bold after");
+        }
+
+        mq_free_result(result);
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_options_html_escapes_raw_html() {
+        let engine = mq_create();
+        let input = make_c_string("<script>alert(1)</script>\n");
+        let format = make_c_string("markdown");
+
+        for (code, allow_dangerous_html, expected) in [
+            ("self", false, "&lt;script&gt;alert(1)&lt;/script&gt;"),
+            ("self", true, "<script>alert(1)</script>"),
+            (r#""**not bold** <b>""#, false, "**not bold** &lt;b&gt;"),
+        ] {
+            let code = make_c_string(code);
+            let options = MqEvalOptions {
+                output_format: MqOutputFormat::Html,
+                allow_dangerous_html,
+                ..Default::default()
+            };
+            let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+            assert!(result.error_msg.is_null(), "{}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert_eq!(result.values_len, 1);
+            unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                assert_eq!(c_string_to_rust_string(values_slice[0]).trim(), expected);
+                mq_free_string(code as *mut c_char);
+            }
+            mq_free_result(result);
+        }
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_options_json_output() {
+        let engine = mq_create();
+        let options = MqEvalOptions {
+            output_format: MqOutputFormat::Json,
+            ..Default::default()
+        };
+
+        for (code, input, format) in [(".h", "# Header\n", "markdown"), ("upcase()", "hello", "text")] {
+            let code = make_c_string(code);
+            let input = make_c_string(input);
+            let format = make_c_string(format);
+
+            let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+            assert!(result.error_msg.is_null(), "{}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert_eq!(result.values_len, 1);
+            let json: serde_json::Value = unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                serde_json::from_str(&c_string_to_rust_string(values_slice[0])).unwrap()
+            };
+            if json.is_object() {
+                assert_eq!(json["type"], "Heading");
+                assert_eq!(json["depth"], 1);
+                assert_eq!(json["position"]["start"]["line"], 1);
+            } else {
+                assert_eq!(json, "HELLO");
+            }
+
+            mq_free_result(result);
+            unsafe {
+                mq_free_string(code as *mut c_char);
+                mq_free_string(input as *mut c_char);
+                mq_free_string(format as *mut c_char);
+            }
+        }
+
+        mq_destroy(engine);
+    }
+
+    #[test]
+    fn test_eval_with_options_yaml_output() {
+        let engine = mq_create();
+        let code = make_c_string(r#"self["title"]"#);
+        let input = make_c_string(r#"{"title": "Intro"}"#);
+        let format = make_c_string("json");
+        let options = MqEvalOptions {
+            output_format: MqOutputFormat::Yaml,
+            ..Default::default()
+        };
+
+        let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+        assert!(result.error_msg.is_null(), "{}", unsafe {
+            c_string_to_rust_string(result.error_msg)
+        });
+        assert_eq!(result.values_len, 1);
+        unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            assert_eq!(c_string_to_rust_string(values_slice[0]).trim(), "Intro");
+        }
+
+        mq_free_result(result);
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_options_list_style() {
+        let engine = mq_create();
+        let code = make_c_string("self");
+        let input = make_c_string("- item\n");
+        let format = make_c_string("markdown");
+
+        for (list_style, expected) in [
+            (MqListStyle::Dash, "- item"),
+            (MqListStyle::Plus, "+ item"),
+            (MqListStyle::Star, "* item"),
+        ] {
+            let options = MqEvalOptions {
+                list_style,
+                ..Default::default()
+            };
+            let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+            assert!(result.error_msg.is_null(), "{}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert_eq!(result.values_len, 1);
+            unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                assert_eq!(c_string_to_rust_string(values_slice[0]).trim(), expected);
+            }
+            mq_free_result(result);
+        }
+
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_eval_with_options_link_styles() {
+        let engine = mq_create();
+        let code = make_c_string(".link");
+        let input = make_c_string("[a](https://example.com \"T\")\n");
+        let format = make_c_string("markdown");
+
+        for (link_url_style, link_title_style, expected) in [
+            (
+                MqLinkUrlStyle::None,
+                MqLinkTitleStyle::Double,
+                r#"[a](https://example.com "T")"#,
+            ),
+            (
+                MqLinkUrlStyle::Angle,
+                MqLinkTitleStyle::Single,
+                "[a](<https://example.com> 'T')",
+            ),
+            (
+                MqLinkUrlStyle::None,
+                MqLinkTitleStyle::Paren,
+                "[a](https://example.com (T))",
+            ),
+        ] {
+            let options = MqEvalOptions {
+                link_url_style,
+                link_title_style,
+                ..Default::default()
+            };
+            let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+            assert!(result.error_msg.is_null(), "{}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert_eq!(result.values_len, 1);
+            unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                assert_eq!(c_string_to_rust_string(values_slice[0]).trim(), expected);
+            }
+            mq_free_result(result);
+        }
 
-        mq_free_result(result);
         mq_destroy(engine);
-
         unsafe {
             mq_free_string(code as *mut c_char);
             mq_free_string(input as *mut c_char);
@@ -833,25 +2373,37 @@ mod tests {
     }
 
     #[test]
-    fn test_eval_with_null_parameters() {
+    fn test_eval_with_obsidian_syntax() {
         let engine = mq_create();
+        let format = make_c_string("markdown");
 
-        // Test with null code
-        let result = unsafe { mq_eval(engine, ptr::null(), make_c_string("test"), make_c_string("text")) };
-        assert!(result.error_msg.is_null());
-        mq_free_result(result);
-
-        // Test with null input
-        let result = unsafe { mq_eval(engine, make_c_string(".a"), ptr::null(), make_c_string("text")) };
-        assert!(!result.error_msg.is_null());
-        mq_free_result(result);
+        for (code, input, expected) in [
+            (".wikilink | .url", "[[My Notes]]", "My Notes"),
+            (".embed | .url", "![[image.png]]", "image.png"),
+            (".callout | .kind", "> [!NOTE]\n> body", "NOTE"),
+        ] {
+            let code = make_c_string(code);
+            let input = make_c_string(input);
+
+            let result = unsafe { mq_eval(engine, code, input, format) };
+            assert!(result.error_msg.is_null(), "{}", unsafe {
+                c_string_to_rust_string(result.error_msg)
+            });
+            assert!(result.values_len > 0);
+            unsafe {
+                let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+                assert_eq!(c_string_to_rust_string(values_slice[0]), expected);
+            }
 
-        // Test with null format
-        let result = unsafe { mq_eval(engine, make_c_string(".a"), make_c_string("test"), ptr::null()) };
-        assert!(!result.error_msg.is_null());
-        mq_free_result(result);
+            mq_free_result(result);
+            unsafe {
+                mq_free_string(code as *mut c_char);
+                mq_free_string(input as *mut c_char);
+            }
+        }
 
         mq_destroy(engine);
+        unsafe { mq_free_string(format as *mut c_char) };
     }
 
     #[test]
@@ -998,6 +2550,76 @@ mod tests {
         assert_eq!(result.unwrap(), "");
     }
 
+    #[test]
+    fn test_catch_panic_result_reports_panic_as_error() {
+        let result = catch_panic_result(|| panic!("forced panic"));
+        assert!(result.values.is_null());
+        assert_eq!(result.values_len, 0);
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "Internal error: mq panicked: forced panic"
+        );
+        mq_free_result(result);
+    }
+
+    #[test]
+    fn test_engine_usable_after_caught_panic() {
+        let engine = mq_create();
+        let code = make_c_string(".h");
+        let input = make_c_string("# Title");
+        let format = make_c_string("markdown");
+
+        let result = catch_panic_result(|| {
+            mq_free_result(unsafe { mq_eval(engine, code, input, format) });
+            panic!("forced panic")
+        });
+        assert!(!result.error_msg.is_null());
+        mq_free_result(result);
+
+        let result = unsafe { mq_eval(engine, code, input, format) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 1);
+        mq_free_result(result);
+
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+        mq_destroy(engine);
+    }
+
+    #[test]
+    fn test_catch_panic_c_string_reports_panic_as_error() {
+        let mut error_msg: *mut c_char = ptr::null_mut();
+
+        let markdown = catch_panic_c_string(Some(&mut error_msg), || panic!("forced panic"));
+        assert!(markdown.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(error_msg) },
+            "Internal error: mq panicked: forced panic"
+        );
+        unsafe { mq_free_string(error_msg) };
+
+        let markdown = catch_panic_c_string(None, || Err("ignored".to_string()));
+        assert!(markdown.is_null());
+    }
+
+    #[test]
+    fn test_catch_panic_returns_value() {
+        assert_eq!(catch_panic(|| 42), Ok(42));
+    }
+
+    #[test]
+    fn test_catch_panic_reports_message() {
+        let result: Result<(), String> = catch_panic(|| panic!("boom"));
+        assert_eq!(result, Err("Internal error: mq panicked: boom".to_string()));
+
+        let reason = String::from("formatted boom");
+        let result: Result<(), String> = catch_panic(|| panic!("{}", reason));
+        assert_eq!(result, Err("Internal error: mq panicked: formatted boom".to_string()));
+    }
+
     #[test]
     fn test_to_c_string() {
         // Test with valid string
@@ -1135,6 +2757,61 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_json_to_markdown_roundtrip() {
+        let engine = mq_create();
+        let code = make_c_string(".h");
+        let input = make_c_string("# Hello\n");
+        let format = make_c_string("markdown");
+        let options = MqEvalOptions {
+            output_format: MqOutputFormat::Json,
+            ..Default::default()
+        };
+
+        let result = unsafe { mq_eval_with_options(engine, code, input, format, options) };
+        assert_eq!(result.values_len, 1);
+        let mut error_msg: *mut c_char = ptr::null_mut();
+        let markdown = unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            mq_json_to_markdown(values_slice[0], &mut error_msg)
+        };
+
+        assert!(error_msg.is_null());
+        assert_eq!(unsafe { c_string_to_rust_string(markdown) }, "# Hello\n");
+
+        mq_free_result(result);
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(markdown);
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_json_to_markdown_invalid_input() {
+        let json = make_c_string("not json");
+        let mut error_msg: *mut c_char = ptr::null_mut();
+
+        let markdown = unsafe { mq_json_to_markdown(json, &mut error_msg) };
+        assert!(markdown.is_null());
+        assert!(unsafe { c_string_to_rust_string(error_msg) }.contains("JSON to Markdown conversion error"));
+        unsafe { mq_free_string(error_msg) };
+
+        let markdown = unsafe { mq_json_to_markdown(ptr::null(), &mut error_msg) };
+        assert!(markdown.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(error_msg) },
+            "JSON input pointer is null"
+        );
+
+        unsafe {
+            mq_free_string(error_msg);
+            mq_free_string(json as *mut c_char);
+        }
+    }
+
     #[test]
     fn test_conversion_options_default() {
         let options = MqConversionOptions::default();
@@ -1249,6 +2926,126 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_set_sandbox_blocks_env_access() {
+        // Cargo sets `CARGO_MANIFEST_DIR` for the test process, so no global env mutation is needed.
+        let sandboxed = mq_create();
+        let trusted = mq_create();
+        let code = make_c_string("$CARGO_MANIFEST_DIR");
+        let input = make_c_string("test");
+        let format = make_c_string("text");
+
+        mq_set_sandbox(sandboxed, true);
+        let result = unsafe { mq_eval(sandboxed, code, input, format) };
+        assert!(!result.error_msg.is_null());
+        mq_free_result(result);
+
+        // The sandbox is per engine, so another engine still sees the environment.
+        let result = unsafe { mq_eval(trusted, code, input, format) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 1);
+        unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            assert_eq!(c_string_to_rust_string(values_slice[0]), env!("CARGO_MANIFEST_DIR"));
+        }
+        mq_free_result(result);
+
+        // Should not crash when the engine pointer is null.
+        mq_set_sandbox(ptr::null_mut(), true);
+
+        mq_destroy(sandboxed);
+        mq_destroy(trusted);
+        unsafe {
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_set_sandbox_blocks_module_search_paths() {
+        let dir = std::env::temp_dir().join("mq_ffi_sandbox_modules");
+        std::fs::create_dir_all(&dir).unwrap();
+        std::fs::write(dir.join("mq_ffi_sandbox_module.mq"), "def triple(x): x * 3;").unwrap();
+
+        let engine = mq_create();
+        let dir_c = make_c_string(dir.to_str().unwrap());
+        let paths: [*const c_char; 1] = [dir_c];
+        unsafe { mq_set_search_paths(engine, paths.as_ptr(), paths.len()) };
+        mq_set_sandbox(engine, true);
+
+        let module_name = make_c_string("mq_ffi_sandbox_module");
+        let error_msg = unsafe { mq_import_module(engine, module_name) };
+        assert!(!error_msg.is_null());
+        assert!(unsafe { c_string_to_rust_string(error_msg) }.contains("sandbox"));
+
+        // Standard library modules are still available.
+        let code = make_c_string(r#"import "csv" | "ok""#);
+        let input = make_c_string("a,b\n");
+        let format = make_c_string("text");
+        let result = unsafe { mq_eval(engine, code, input, format) };
+        assert!(result.error_msg.is_null(), "{}", unsafe {
+            c_string_to_rust_string(result.error_msg)
+        });
+        mq_free_result(result);
+
+        std::fs::remove_dir_all(&dir).ok();
+        mq_destroy(engine);
+        unsafe {
+            mq_free_string(error_msg);
+            mq_free_string(dir_c as *mut c_char);
+            mq_free_string(module_name as *mut c_char);
+            mq_free_string(code as *mut c_char);
+            mq_free_string(input as *mut c_char);
+            mq_free_string(format as *mut c_char);
+        }
+    }
+
+    #[test]
+    fn test_interrupt_stops_running_eval() {
+        let engine = mq_create();
+        let handle = mq_interrupt_handle(engine);
+        let (sender, receiver) = std::sync::mpsc::channel();
+
+        let evaluator = {
+            let engine = engine as usize;
+            std::thread::spawn(move || {
+                let code = make_c_string("loop: 1;");
+                let input = make_c_string("test");
+                let format = make_c_string("text");
+                let result = unsafe { mq_eval(engine as *mut MqContext, code, input, format) };
+                let error_msg = unsafe { c_string_to_rust_string(result.error_msg) };
+                mq_free_result(result);
+                unsafe {
+                    mq_free_string(code as *mut c_char);
+                    mq_free_string(input as *mut c_char);
+                    mq_free_string(format as *mut c_char);
+                }
+                sender.send(error_msg).unwrap();
+            })
+        };
+
+        // A single request, made once eval is well under way, must be enough to stop it.
+        std::thread::sleep(std::time::Duration::from_millis(100));
+        mq_interrupt(handle);
+        let error_msg = receiver
+            .recv_timeout(std::time::Duration::from_secs(10))
+            .expect("eval was not interrupted within 10 seconds");
+        evaluator.join().unwrap();
+
+        assert!(error_msg.contains("interrupted"), "{}", error_msg);
+
+        mq_free_interrupt_handle(handle);
+        mq_destroy(engine);
+    }
+
+    #[test]
+    fn test_interrupt_handle_null_does_not_crash() {
+        assert!(mq_interrupt_handle(ptr::null_mut()).is_null());
+        mq_interrupt(ptr::null_mut());
+        mq_free_interrupt_handle(ptr::null_mut());
+    }
+
     #[test]
     fn test_define_string_value_and_use_in_eval() {
         let engine = mq_create();
@@ -1516,6 +3313,244 @@ mod tests {
         mq_destroy(engine);
     }
 
+    #[test]
+    #[cfg(feature = "lint")]
+    fn test_lint_reports_findings() {
+        let code = make_c_string("let x = .h1");
+
+        let result = unsafe { mq_lint(code) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 1);
+        let finding: serde_json::Value = unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            serde_json::from_str(&c_string_to_rust_string(values_slice[0])).unwrap()
+        };
+        assert_eq!(finding["rule"], "unused_variable");
+        assert!(finding["message"].as_str().unwrap().contains("unused variable `x`"));
+        assert_eq!(finding["range"]["start"]["line"], 1);
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(feature = "lint")]
+    fn test_lint_clean_code() {
+        let code = make_c_string("let x = .h1 | x");
+
+        let result = unsafe { mq_lint(code) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 0);
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(not(feature = "lint"))]
+    fn test_lint_without_feature_returns_error() {
+        let code = make_c_string("let x = .h1");
+
+        let result = unsafe { mq_lint(code) };
+        assert!(result.values.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "This library was built without the lint feature"
+        );
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(feature = "analysis")]
+    fn test_defined_functions_returns_docs() {
+        let code = make_c_string("# Adds one.\n# Works on numbers.\ndef inc(x): x + 1;\ndef twice(f, v): f(f(v));");
+
+        let result = unsafe { mq_defined_functions(code) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 2);
+        let functions: Vec<serde_json::Value> = unsafe {
+            std::slice::from_raw_parts(result.values, result.values_len)
+                .iter()
+                .map(|&value| serde_json::from_str(&c_string_to_rust_string(value)).unwrap())
+                .collect()
+        };
+        assert_eq!(functions[0]["name"], "inc");
+        assert_eq!(functions[0]["params"], serde_json::json!(["x"]));
+        assert_eq!(functions[0]["doc"], "Adds one.\nWorks on numbers.");
+        assert_eq!(functions[1]["name"], "twice");
+        assert_eq!(functions[1]["params"], serde_json::json!(["f", "v"]));
+        assert_eq!(functions[1]["doc"], "");
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(feature = "analysis")]
+    fn test_defined_functions_skips_lambdas_and_nested_defs() {
+        let code =
+            make_c_string("def inc_all(xs): map(xs, fn(x): x + 1;);\ndef outer(x): def inner(y): y * 2; | inner(x);");
+
+        let result = unsafe { mq_defined_functions(code) };
+        assert!(result.error_msg.is_null());
+        let names: Vec<String> = unsafe {
+            std::slice::from_raw_parts(result.values, result.values_len)
+                .iter()
+                .map(|&value| {
+                    let function: serde_json::Value = serde_json::from_str(&c_string_to_rust_string(value)).unwrap();
+                    function["name"].as_str().unwrap().to_string()
+                })
+                .collect()
+        };
+        assert_eq!(names, vec!["inc_all", "outer"]);
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(not(feature = "analysis"))]
+    fn test_defined_functions_without_feature_returns_error() {
+        let code = make_c_string("def inc(x): x + 1;");
+
+        let result = unsafe { mq_defined_functions(code) };
+        assert!(result.values.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "This library was built without the analysis feature"
+        );
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(feature = "analysis")]
+    fn test_complete_includes_user_and_builtin_symbols() {
+        let code = make_c_string("# Greets by name.\ndef greet(name): s\"Hello ${name}\"; | let title = .h1 | title");
+
+        let result = unsafe { mq_complete(code, 2, 60) };
+        assert!(result.error_msg.is_null());
+        let candidates: Vec<serde_json::Value> = unsafe {
+            std::slice::from_raw_parts(result.values, result.values_len)
+                .iter()
+                .map(|&value| serde_json::from_str(&c_string_to_rust_string(value)).unwrap())
+                .collect()
+        };
+        let find = |label: &str| candidates.iter().find(|c| c["label"] == label).cloned();
+
+        let greet = find("greet").unwrap();
+        assert_eq!(greet["kind"], "function");
+        assert_eq!(greet["params"], serde_json::json!(["name"]));
+        assert_eq!(greet["doc"], "Greets by name.");
+        assert_eq!(find("title").unwrap()["kind"], "variable");
+        assert_eq!(find("upcase").unwrap()["kind"], "function");
+        assert_eq!(candidates.iter().filter(|c| c["label"] == "upcase").count(), 1);
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(not(feature = "analysis"))]
+    fn test_complete_without_feature_returns_error() {
+        let code = make_c_string("up");
+
+        let result = unsafe { mq_complete(code, 1, 3) };
+        assert!(result.values.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "This library was built without the analysis feature"
+        );
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    fn test_tokenize_returns_categories() {
+        let code = make_c_string("let x = .h1 # heading\n| upcase(\"a\")");
+
+        let result = unsafe { mq_tokenize(code) };
+        assert!(result.error_msg.is_null());
+        let tokens: Vec<serde_json::Value> = unsafe {
+            std::slice::from_raw_parts(result.values, result.values_len)
+                .iter()
+                .map(|&value| serde_json::from_str(&c_string_to_rust_string(value)).unwrap())
+                .collect()
+        };
+        let kinds = tokens.iter().map(|t| t["kind"].as_str().unwrap()).collect::<Vec<_>>();
+        assert_eq!(
+            kinds,
+            vec![
+                "keyword",
+                "ident",
+                "operator",
+                "selector",
+                "comment",
+                "operator",
+                "ident",
+                "punctuation",
+                "string",
+                "punctuation"
+            ]
+        );
+        assert_eq!(tokens[3]["range"]["start"]["column"], 9);
+        assert_eq!(tokens[5]["range"]["start"]["line"], 2);
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(feature = "ast-json")]
+    fn test_parse_ast_returns_json() {
+        let code = make_c_string(".h1 | upcase()");
+
+        let result = unsafe { mq_parse_ast(code) };
+        assert!(result.error_msg.is_null());
+        assert_eq!(result.values_len, 1);
+        let ast: serde_json::Value = unsafe {
+            let values_slice = std::slice::from_raw_parts(result.values, result.values_len);
+            serde_json::from_str(&c_string_to_rust_string(values_slice[0])).unwrap()
+        };
+        assert_eq!(ast.as_array().map(|nodes| nodes.len()), Some(2));
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(feature = "ast-json")]
+    fn test_parse_ast_invalid_code() {
+        let code = make_c_string("def f(");
+
+        let result = unsafe { mq_parse_ast(code) };
+        assert!(result.values.is_null());
+        assert!(unsafe { c_string_to_rust_string(result.error_msg) }.starts_with("Error parsing query"));
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
+    #[test]
+    #[cfg(not(feature = "ast-json"))]
+    fn test_parse_ast_without_feature_returns_error() {
+        let code = make_c_string(".h1");
+
+        let result = unsafe { mq_parse_ast(code) };
+        assert!(result.values.is_null());
+        assert_eq!(
+            unsafe { c_string_to_rust_string(result.error_msg) },
+            "This library was built without the ast-json feature"
+        );
+
+        mq_free_result(result);
+        unsafe { mq_free_string(code as *mut c_char) };
+    }
+
     #[test]
     fn test_clear_http_cache() {
         let engine = mq_create();
@@ -3,6 +3,8 @@
 #include <string.h>
 #include <stdbool.h>
 #include <assert.h>
+#include <pthread.h>
+#include <unistd.h>
 #include "mq.h"
 
 #define TEST_MODULE_DIR "/tmp"
@@ -36,6 +38,14 @@ void assert_str_equals(const char *a, const char *b, const char *msg) {
     }
 }
 
+void assert_str_contains(const char *haystack, const char *needle, const char *msg) {
+    if (haystack == NULL || strstr(haystack, needle) == NULL) {
+        fprintf(stderr, "FAIL: %s\n  Expected to contain: %s\n  Got: %s\n", msg, needle,
+                haystack == NULL ? "(null)" : haystack);
+        exit(1);
+    }
+}
+
 void test_create_destroy() {
     printf("Test 1: Create and destroy engine... ");
 
@@ -481,6 +491,241 @@ void test_clear_http_cache_does_not_crash() {
     printf("PASS\n");
 }
 
+void test_eval_with_options() {
+    printf("Test 24: mq_eval_with_options... ");
+
+    mq_context_t *engine = mq_create();
+
+    // A zero-initialized options struct, passed by value, behaves like mq_eval.
+    MqEvalOptions defaults = {0};
+    struct mq_result_t result = mq_eval_with_options(engine, ".h", "# **Hello**", "markdown", defaults);
+    assert_null(result.error_msg, "Should not have error with default options");
+    assert_equals(result.values_len, 1, "Should have 1 value");
+    assert_str_contains(result.values[0], "# **Hello**", "Default output should be markdown");
+    mq_free_result(result);
+
+    MqEvalOptions html = {.output_format = MqOutputFormat_Html};
+    result = mq_eval_with_options(engine, ".h", "# **Hello**", "markdown", html);
+    assert_null(result.error_msg, "Should not have error with HTML output");
+    assert_str_contains(result.values[0], "<h1><strong>Hello</strong></h1>", "HTML output mismatch");
+    mq_free_result(result);
+
+    // Raw HTML is escaped unless explicitly allowed.
+    result = mq_eval_with_options(engine, "self", "<script>alert(1)</script>\n", "markdown", html);
+    assert_null(result.error_msg, "Should not have error rendering raw HTML");
+    assert_str_contains(result.values[0], "&lt;script&gt;", "Raw HTML should be escaped");
+    mq_free_result(result);
+
+    html.allow_dangerous_html = true;
+    result = mq_eval_with_options(engine, "self", "<script>alert(1)</script>\n", "markdown", html);
+    assert_null(result.error_msg, "Should not have error rendering raw HTML");
+    assert_str_contains(result.values[0], "<script>", "Raw HTML should pass through when allowed");
+    mq_free_result(result);
+
+    MqEvalOptions list = {.output_format = MqOutputFormat_Markdown, .list_style = MqListStyle_Star};
+    result = mq_eval_with_options(engine, "self", "- item\n", "markdown", list);
+    assert_null(result.error_msg, "Should not have error with list style");
+    assert_str_contains(result.values[0], "* item", "List style should be applied");
+    mq_free_result(result);
+
+    MqEvalOptions link = {.link_url_style = MqLinkUrlStyle_Angle, .link_title_style = MqLinkTitleStyle_Single};
+    result = mq_eval_with_options(engine, ".link", "[a](https://example.com \"T\")\n", "markdown", link);
+    assert_null(result.error_msg, "Should not have error with link styles");
+    assert_str_contains(result.values[0], "[a](<https://example.com> 'T')", "Link styles should be applied");
+    mq_free_result(result);
+
+    mq_destroy(engine);
+
+    printf("PASS\n");
+}
+
+void test_json_output_roundtrip() {
+    printf("Test 25: JSON output + mq_json_to_markdown... ");
+
+    mq_context_t *engine = mq_create();
+    MqEvalOptions json = {.output_format = MqOutputFormat_Json};
+
+    struct mq_result_t result = mq_eval_with_options(engine, ".h", "# Hello\n", "markdown", json);
+    assert_null(result.error_msg, "Should not have error with JSON output");
+    assert_equals(result.values_len, 1, "Should have 1 value");
+
+    char *error_msg = NULL;
+    char *markdown = mq_json_to_markdown(result.values[0], &error_msg);
+    assert_null(error_msg, "Should not have error converting JSON back");
+    assert_str_equals(markdown, "# Hello\n", "Round-tripped markdown mismatch");
+
+    mq_free_string(markdown);
+    mq_free_result(result);
+
+    markdown = mq_json_to_markdown("not json", &error_msg);
+    assert_null(markdown, "Markdown should be null for invalid JSON");
+    assert_not_null(error_msg, "Should have error message for invalid JSON");
+    mq_free_string(error_msg);
+
+    mq_destroy(engine);
+
+    printf("PASS\n");
+}
+
+void test_eval_bytes() {
+    printf("Test 26: mq_eval_bytes... ");
+
+    mq_context_t *engine = mq_create();
+
+    // The length is a size_t, so input containing NUL bytes is passed through intact.
+    const char input[] = {'a', '\0', 'b'};
+    size_t input_len = sizeof(input);
+    struct mq_result_t result = mq_eval_bytes(engine, "len()", (const uint8_t *)input, input_len, "text");
+    assert_null(result.error_msg, "Should not have error");
+    assert_equals(result.values_len, 1, "Should have 1 value");
+    assert_str_equals(result.values[0], "3", "Whole input including NUL should be evaluated");
+    mq_free_result(result);
+
+    // A result containing a NUL byte cannot be returned as a C string, so it is an error.
+    result = mq_eval_bytes(engine, "self", (const uint8_t *)input, input_len, "text");
+    assert_null(result.values, "Values should be null");
+    assert_not_null(result.error_msg, "Should have error for NUL in result");
+    mq_free_result(result);
+
+    result = mq_eval_bytes(engine, "self", NULL, 5, "text");
+    assert_not_null(result.error_msg, "Should have error for null input");
+    assert_str_equals(result.error_msg, "Input pointer is null", "Error message mismatch");
+    mq_free_result(result);
+
+    mq_destroy(engine);
+
+    printf("PASS\n");
+}
+
+void test_is_supported_input_format() {
+    printf("Test 27: mq_is_supported_input_format... ");
+
+    assert(mq_is_supported_input_format("markdown"));
+    assert(mq_is_supported_input_format("MDX"));
+    assert(mq_is_supported_input_format("ipynb"));
+    assert(!mq_is_supported_input_format("docx"));
+    assert(!mq_is_supported_input_format(NULL));
+
+    printf("PASS\n");
+}
+
+void test_set_sandbox() {
+    printf("Test 28: mq_set_sandbox... ");
+
+    mq_context_t *sandboxed = mq_create();
+    mq_context_t *trusted = mq_create();
+    mq_set_sandbox(sandboxed, true);
+
+    struct mq_result_t result = mq_eval(sandboxed, "$PATH", "test", "text");
+    assert_not_null(result.error_msg, "Sandboxed engine should not read the environment");
+    mq_free_result(result);
+
+    result = mq_eval(sandboxed, "read_file(\"/etc/hostname\")", "test", "text");
+    assert_not_null(result.error_msg, "Sandboxed engine should not read files");
+    mq_free_result(result);
+
+    // The sandbox only applies to the engine it was set on.
+    result = mq_eval(trusted, "$PATH", "test", "text");
+    assert_null(result.error_msg, "Trusted engine should read the environment");
+    mq_free_result(result);
+
+    mq_set_sandbox(sandboxed, false);
+    result = mq_eval(sandboxed, "$PATH", "test", "text");
+    assert_null(result.error_msg, "Engine should read the environment once the sandbox is disabled");
+    mq_free_result(result);
+
+    // Should not crash with a null engine.
+    mq_set_sandbox(NULL, true);
+
+    mq_destroy(sandboxed);
+    mq_destroy(trusted);
+
+    printf("PASS\n");
+}
+
+// Sends a single interrupt once the eval on the main thread is well under way. The handle
+// is set before the thread starts and nothing else is shared, so no synchronization is needed.
+static void *interrupt_after_delay(void *handle) {
+    usleep(100 * 1000);
+    mq_interrupt(handle);
+    return NULL;
+}
+
+void test_interrupt() {
+    printf("Test 29: mq_interrupt_handle + mq_interrupt... ");
+
+    mq_context_t *engine = mq_create();
+    mq_interrupt_handle_t *handle = mq_interrupt_handle(engine);
+    assert_not_null(handle, "Interrupt handle should not be null");
+
+    // A request made while no evaluation is running is discarded.
+    mq_interrupt(handle);
+    struct mq_result_t result = mq_eval(engine, "len()", "abc", "text");
+    assert_null(result.error_msg, "Stale interrupt should not stop the next eval");
+    mq_free_result(result);
+
+    // Abort instead of hanging if the interrupt never lands.
+    alarm(10);
+    pthread_t thread;
+    if (pthread_create(&thread, NULL, interrupt_after_delay, handle) != 0) {
+        fprintf(stderr, "FAIL: Should be able to start the interrupter thread\n");
+        exit(1);
+    }
+    result = mq_eval(engine, "loop: 1;", "test", "text");
+    pthread_join(thread, NULL);
+    alarm(0);
+
+    assert_not_null(result.error_msg, "Running eval should be interrupted");
+    assert_str_contains(result.error_msg, "interrupted", "Error message mismatch");
+    mq_free_result(result);
+
+    // The handle may outlive its engine, and null pointers are ignored.
+    mq_destroy(engine);
+    mq_interrupt(handle);
+    mq_free_interrupt_handle(handle);
+    assert_null(mq_interrupt_handle(NULL), "Handle for null engine should be null");
+    mq_interrupt(NULL);
+    mq_free_interrupt_handle(NULL);
+
+    printf("PASS\n");
+}
+
+void test_tokenize() {
+    printf("Test 30: mq_tokenize... ");
+
+    struct mq_result_t result = mq_tokenize("let x = .h1");
+    assert_null(result.error_msg, "Should not have error");
+    assert_equals(result.values_len, 4, "Should have 4 tokens");
+    assert_str_contains(result.values[0], "\"kind\":\"keyword\"", "First token should be a keyword");
+    assert_str_contains(result.values[3], "\"kind\":\"selector\"", "Last token should be a selector");
+    mq_free_result(result);
+
+    printf("PASS\n");
+}
+
+void test_analysis_without_features() {
+    printf("Test 31: analysis functions without their features... ");
+
+    // This build uses the default features, so these report that they are unavailable.
+    struct mq_result_t result = mq_parse_ast(".h");
+    assert_str_contains(result.error_msg, "ast-json feature", "mq_parse_ast error mismatch");
+    mq_free_result(result);
+
+    result = mq_lint(".h");
+    assert_str_contains(result.error_msg, "lint feature", "mq_lint error mismatch");
+    mq_free_result(result);
+
+    result = mq_defined_functions("def inc(x): x + 1;");
+    assert_str_contains(result.error_msg, "analysis feature", "mq_defined_functions error mismatch");
+    mq_free_result(result);
+
+    result = mq_complete(".h", 1, 1);
+    assert_str_contains(result.error_msg, "analysis feature", "mq_complete error mismatch");
+    mq_free_result(result);
+
+    printf("PASS\n");
+}
+
 int main() {
     printf("Running mq-ffi C tests...\n\n");
 
@@ -507,6 +752,14 @@ int main() {
     test_set_search_paths_edge_cases();
     test_http_allowed_domains_does_not_crash();
     test_clear_http_cache_does_not_crash();
+    test_eval_with_options();
+    test_json_output_roundtrip();
+    test_eval_bytes();
+    test_is_supported_input_format();
+    test_set_sandbox();
+    test_interrupt();
+    test_tokenize();
+    test_analysis_without_features();
 
     printf("\nAll tests passed!\n");
     return 0;
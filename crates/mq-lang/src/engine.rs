@@ -1,6 +1,8 @@
 #[cfg(feature = "debugger")]
 use std::borrow::Cow;
 use std::path::PathBuf;
+use std::sync::Arc;
+use std::sync::atomic::{AtomicBool, Ordering};
 
 use crate::eval::builtin::capability;
 #[cfg(feature = "debugger")]
@@ -52,6 +54,25 @@ impl From<crate::ast::Program> for CompiledProgram {
     }
 }
 
+/// A thread-safe handle for stopping an [`Engine`]'s running evaluation, returned by
+/// [`Engine::interrupt_handle`].
+///
+/// Calling [`interrupt`](Self::interrupt) makes the in-flight `eval` call return
+/// `RuntimeError::Interrupted` at its next periodic check. A request made while no
+/// evaluation is running is discarded when the next `eval` or `compile` call starts, before
+/// it parses anything, so a request made while the query is parsed is not lost. A request
+/// made after `compile` returns stops the following `eval_compiled` call, which lets a host
+/// do its own work, such as parsing the input, in between without missing an interrupt.
+#[derive(Debug, Clone)]
+pub struct InterruptHandle(Arc<AtomicBool>);
+
+impl InterruptHandle {
+    /// Requests that the current evaluation stop.
+    pub fn interrupt(&self) {
+        self.0.store(true, Ordering::Relaxed);
+    }
+}
+
 /// The main execution engine for the mq.
 ///
 /// The `Engine` manages parsing, optimization, and evaluation of mq code.
@@ -74,6 +95,7 @@ pub struct Engine<T: ModuleResolver = DefaultModuleResolver> {
     pub(crate) evaluator: Evaluator<T>,
     token_arena: Shared<SharedCell<Arena<Shared<Token>>>>,
     optimization_level: OptimizationLevel,
+    sandboxed: bool,
 }
 
 fn create_default_token_arena() -> Shared<SharedCell<Arena<Shared<Token>>>> {
@@ -103,6 +125,7 @@ impl<T: ModuleResolver> Engine<T> {
             evaluator: Evaluator::new(ModuleLoader::new(module_resolver), Shared::clone(&token_arena)),
             token_arena,
             optimization_level: OptimizationLevel::default(),
+            sandboxed: false,
         }
     }
 
@@ -128,6 +151,11 @@ impl<T: ModuleResolver> Engine<T> {
         self.evaluator.options.timeout = Some(timeout);
     }
 
+    /// Returns a handle that can stop this engine's running evaluation from another thread.
+    pub fn interrupt_handle(&self) -> InterruptHandle {
+        InterruptHandle(Arc::clone(&self.evaluator.interrupted))
+    }
+
     /// Enables or disables the `http` builtin for the current process.
     ///
     /// Disabled by default. This is a process-wide setting (see
@@ -152,6 +180,29 @@ impl<T: ModuleResolver> Engine<T> {
         capability::set_allow_write(allow);
     }
 
+    /// Enables or disables `$NAME` environment variable references for the current process.
+    ///
+    /// Enabled by default. When disabled, every reference fails as if the variable were unset.
+    /// This is a process-wide setting (see
+    /// [`capability`](crate::eval::builtin::capability)), not per-`Engine`.
+    pub fn set_allow_env(&self, allow: bool) {
+        capability::set_allow_env(allow);
+    }
+
+    /// Enables or disables sandbox mode for this engine, for running untrusted mq code.
+    ///
+    /// Disabled by default. While enabled, `$NAME` environment variable references fail as if
+    /// the variable were unset, the `http`, `read_file`, `read_file_bytes`, `collection`,
+    /// `file_exists` and `write_file` builtins are rejected even if the process-wide
+    /// [`capability`](crate::eval::builtin::capability) flags allow them, and modules can only
+    /// be loaded from the standard library: the filesystem search paths and HTTP imports are
+    /// not consulted. Modules the host loads
+    /// before enabling the sandbox stay available. Other engines are not affected.
+    pub fn set_sandbox(&mut self, enabled: bool) {
+        self.sandboxed = enabled;
+        self.evaluator.module_loader.set_sandboxed(enabled);
+    }
+
     /// Set search paths for module loading.
     ///
     /// These paths will be searched when loading external modules
@@ -188,6 +239,7 @@ impl<T: ModuleResolver> Engine<T> {
     /// The module will be searched for in the configured search paths
     /// and made available for use in mq code.
     pub fn import_module(&mut self, module_name: &str) -> Result<(), Box<error::Error>> {
+        let _sandbox = capability::SandboxScope::enter(self.sandboxed);
         let module = self
             .evaluator
             .module_loader
@@ -211,6 +263,7 @@ impl<T: ModuleResolver> Engine<T> {
     /// The module will be searched for in the configured search paths
     /// and made available for use in mq code.
     pub fn load_module(&mut self, module_name: &str) -> Result<(), Box<error::Error>> {
+        let _sandbox = capability::SandboxScope::enter(self.sandboxed);
         let module = self
             .evaluator
             .module_loader
@@ -244,18 +297,23 @@ impl<T: ModuleResolver> Engine<T> {
     /// ```
     ///
     pub fn eval<I: Iterator<Item = RuntimeValue>>(&mut self, code: &str, input: I) -> MqResult {
+        self.evaluator.interrupted.store(false, Ordering::Relaxed);
         if code.is_empty() {
             return Ok(vec![].into());
         }
 
+        let _sandbox = capability::SandboxScope::enter(self.sandboxed);
         let program = parse(code, Shared::clone(&self.token_arena))?;
         let program = Optimizer::with_level(self.optimization_level).optimize(program);
 
         #[cfg(feature = "debugger")]
         self.evaluator.module_loader.set_source_code(code.to_string());
 
-        self.evaluator
-            .eval(&program, input.into_iter())
+        let result = self.evaluator.eval(&program, input.into_iter());
+        // Drop a request that arrived too late to stop this run, so it cannot stop the next one.
+        self.evaluator.interrupted.store(false, Ordering::Relaxed);
+
+        result
             .map(|values| values.into())
             .map_err(|e| Box::new(error::Error::from_error(code, e, self.evaluator.module_loader.clone())))
     }
@@ -264,12 +322,14 @@ impl<T: ModuleResolver> Engine<T> {
     ///
     /// Use this with `eval_compiled` to avoid re-parsing the same query for each input.
     pub fn compile(&mut self, code: &str) -> Result<CompiledProgram, Box<error::Error>> {
+        self.evaluator.interrupted.store(false, Ordering::Relaxed);
         if code.is_empty() {
             return Ok(CompiledProgram {
                 source: String::new(),
                 program: vec![],
             });
         }
+        let _sandbox = capability::SandboxScope::enter(self.sandboxed);
         let program = parse(code, Shared::clone(&self.token_arena))?;
         let program = Optimizer::with_level(self.optimization_level).optimize(program);
         Ok(CompiledProgram {
@@ -299,19 +359,22 @@ impl<T: ModuleResolver> Engine<T> {
         compiled: &CompiledProgram,
         input: I,
     ) -> MqResult {
+        let _sandbox = capability::SandboxScope::enter(self.sandboxed);
+
         #[cfg(feature = "debugger")]
         self.evaluator.module_loader.set_source_code(compiled.source.clone());
 
-        self.evaluator
-            .eval(&compiled.program, input)
-            .map(|values| values.into())
-            .map_err(|e| {
-                Box::new(error::Error::from_error(
-                    &compiled.source,
-                    e,
-                    self.evaluator.module_loader.clone(),
-                ))
-            })
+        let result = self.evaluator.eval(&compiled.program, input);
+        // Drop a request that arrived too late to stop this run, so it cannot stop the next one.
+        self.evaluator.interrupted.store(false, Ordering::Relaxed);
+
+        result.map(|values| values.into()).map_err(|e| {
+            Box::new(error::Error::from_error(
+                &compiled.source,
+                e,
+                self.evaluator.module_loader.clone(),
+            ))
+        })
     }
 
     /// Returns a reference to the debugger instance.
@@ -345,10 +408,16 @@ impl<T: ModuleResolver> Engine<T> {
         #[cfg(feature = "sync")]
         let token_arena = Shared::new(SharedCell::new(self.token_arena.read().unwrap().clone()));
 
+        let mut evaluator = Evaluator::with_env(Shared::clone(&token_arena), Shared::clone(&env));
+        evaluator.module_loader.set_sandboxed(self.sandboxed);
+        // Share the flag so an `InterruptHandle` taken from this engine also stops the new one.
+        evaluator.interrupted = Arc::clone(&self.evaluator.interrupted);
+
         Self {
-            evaluator: Evaluator::with_env(Shared::clone(&token_arena), Shared::clone(&env)),
+            evaluator,
             token_arena: Shared::clone(&token_arena),
             optimization_level: self.optimization_level,
+            sandboxed: self.sandboxed,
         }
     }
 
@@ -469,6 +538,24 @@ mod tests {
         assert_eq!(engine.evaluator.options.timeout, Some(timeout));
     }
 
+    #[test]
+    fn test_set_sandbox_is_per_engine() {
+        // Cargo sets `CARGO_MANIFEST_DIR` for the test process, so no global env mutation is needed.
+        let code = "$CARGO_MANIFEST_DIR";
+        let mut sandboxed = DefaultEngine::default();
+        sandboxed.set_sandbox(true);
+        let mut trusted = DefaultEngine::default();
+
+        assert!(sandboxed.eval(code, vec!["".to_string().into()].into_iter()).is_err());
+        assert_eq!(
+            trusted.eval(code, vec!["".to_string().into()].into_iter()).unwrap(),
+            vec![env!("CARGO_MANIFEST_DIR").to_string().into()].into()
+        );
+
+        sandboxed.set_sandbox(false);
+        assert!(sandboxed.eval(code, vec!["".to_string().into()].into_iter()).is_ok());
+    }
+
     #[rstest]
     #[case::while_loop("while(true): 1;")]
     #[case::bare_loop("loop: 1;")]
@@ -489,6 +576,55 @@ mod tests {
         assert!(started.elapsed() < std::time::Duration::from_secs(5));
     }
 
+    #[test]
+    fn test_interrupt_stops_running_eval() {
+        let mut engine = DefaultEngine::default();
+        let handle = engine.interrupt_handle();
+
+        // A single request, made once eval is well under way, must be enough to stop it.
+        let interrupter = std::thread::spawn(move || {
+            std::thread::sleep(std::time::Duration::from_millis(100));
+            handle.interrupt();
+        });
+
+        let result = engine.eval("loop: 1;", vec!["".to_string().into()].into_iter());
+        interrupter.join().unwrap();
+
+        assert!(matches!(
+            result.unwrap_err().cause,
+            crate::error::InnerError::Runtime(crate::error::runtime::RuntimeError::Interrupted)
+        ));
+    }
+
+    #[test]
+    fn test_interrupt_after_compile_stops_eval_compiled() {
+        let mut engine = DefaultEngine::default();
+        let endless = engine.compile("loop: 1;").unwrap();
+        let finite = engine.compile("1 + 1").unwrap();
+
+        // The host may do its own work between compile and eval_compiled; a request made
+        // then still applies.
+        engine.interrupt_handle().interrupt();
+        let result = engine.eval_compiled(&endless, vec!["".to_string().into()].into_iter());
+        assert!(matches!(
+            result.unwrap_err().cause,
+            crate::error::InnerError::Runtime(crate::error::runtime::RuntimeError::Interrupted)
+        ));
+
+        // The request was consumed by that run and does not stop the next one.
+        let result = engine.eval_compiled(&finite, vec!["".to_string().into()].into_iter());
+        assert!(result.is_ok());
+    }
+
+    #[test]
+    fn test_interrupt_before_eval_is_discarded() {
+        let mut engine = DefaultEngine::default();
+        engine.interrupt_handle().interrupt();
+
+        let result = engine.eval("1 + 1", vec!["".to_string().into()].into_iter());
+        assert!(result.is_ok());
+    }
+
     #[test]
     fn test_no_timeout_by_default() {
         let mut engine = DefaultEngine::default();
@@ -826,6 +962,38 @@ mod tests {
         );
     }
 
+    #[cfg(feature = "debugger")]
+    #[test]
+    fn test_switch_env_keeps_sandbox_and_interrupt_handle() {
+        use crate::eval::env::Env;
+        use crate::{Shared, SharedCell, null_input};
+
+        let mut engine = DefaultEngine::default();
+        engine.set_sandbox(true);
+        let handle = engine.interrupt_handle();
+        let mut new_engine = engine.switch_env(Shared::new(SharedCell::new(Env::default())));
+
+        let result = new_engine.eval(r#"import "not_a_standard_module""#, null_input().into_iter());
+        assert!(matches!(
+            result.unwrap_err().cause,
+            crate::error::InnerError::Runtime(crate::error::runtime::RuntimeError::ModuleLoadError(
+                crate::module::error::ModuleError::NotAllowedInSandbox(_)
+            ))
+        ));
+
+        let interrupter = std::thread::spawn(move || {
+            std::thread::sleep(std::time::Duration::from_millis(100));
+            handle.interrupt();
+        });
+        let result = new_engine.eval("loop: 1;", null_input().into_iter());
+        interrupter.join().unwrap();
+
+        assert!(matches!(
+            result.unwrap_err().cause,
+            crate::error::InnerError::Runtime(crate::error::runtime::RuntimeError::Interrupted)
+        ));
+    }
+
     #[cfg(feature = "debugger")]
     #[test]
     fn test_get_source_code_for_debug() {
@@ -317,6 +317,9 @@ impl Diagnostic for Error {
             InnerError::Runtime(RuntimeError::Timeout(_)) => Some(Cow::Borrowed(
                 "Execution exceeded the configured timeout. Increase it or simplify the query.",
             )),
+            InnerError::Runtime(RuntimeError::Interrupted) => {
+                Some(Cow::Borrowed("Execution was stopped by the host before it completed."))
+            }
             InnerError::Runtime(RuntimeError::ModuleLoadError(_)) => {
                 Some(Cow::Borrowed("Failed to load module. Check module paths and names."))
             }
@@ -380,6 +383,10 @@ impl Diagnostic for Error {
             ),
             InnerError::Module(ModuleError::SyntaxError(SyntaxError::UnknownSelector(sel))) => Some(selector_help(sel)),
             InnerError::Module(ModuleError::InvalidModule) => Some(Cow::Borrowed("Invalid module format or content.")),
+            InnerError::Module(ModuleError::NotAllowedInSandbox(_)) => Some(Cow::Borrowed(
+                "Sandbox mode blocks filesystem and HTTP modules. \
+                Load trusted modules before enabling the sandbox, or use a standard library module.",
+            )),
             InnerError::Module(ModuleError::SyntaxError(SyntaxError::ParameterWithoutDefaultAfterDefault(_))) => {
                 Some(Cow::Borrowed(
                     "Move this parameter before any parameters that have default values, or give it a default value.",
@@ -955,6 +962,7 @@ mod test {
         })))
     )]
     #[case::module_invalid_module(InnerError::Module(ModuleError::InvalidModule))]
+    #[case::module_not_allowed_in_sandbox(InnerError::Module(ModuleError::NotAllowedInSandbox("mod".into())))]
     #[case::module_parse_error_expected_closing_paren(
         InnerError::Module(ModuleError::SyntaxError(SyntaxError::ExpectedClosingParen(Token {
             range: Range::default(),
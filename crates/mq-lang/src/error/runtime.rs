@@ -37,6 +37,8 @@ pub enum RuntimeError {
     RecursionError(u32),
     #[error("Execution timed out after {:.3}s", .0.as_secs_f64())]
     Timeout(Duration),
+    #[error("Execution was interrupted")]
+    Interrupted,
     #[error(r#"Invalid types for "{}", got {}"#, name, args.join(", "))]
     InvalidTypes {
         token: ErrorToken,
@@ -107,6 +109,7 @@ impl RuntimeError {
             RuntimeError::InvalidDefinition(token, _) => Some(token),
             RuntimeError::RecursionError(_) => None,
             RuntimeError::Timeout(_) => None,
+            RuntimeError::Interrupted => None,
             RuntimeError::InvalidTypes { token, .. } => Some(token),
             RuntimeError::InvalidNumberOfArguments { token, .. } => Some(token),
             RuntimeError::InvalidRegularExpression(token, _) => Some(token),
@@ -156,6 +159,7 @@ mod tests {
     #[case(RuntimeError::InvalidDefinition(eof_token(), "d".to_string()), true)]
     #[case(RuntimeError::RecursionError(10), false)]
     #[case(RuntimeError::Timeout(Duration::from_secs(1)), false)]
+    #[case(RuntimeError::Interrupted, false)]
     #[case(RuntimeError::InvalidTypes { token: eof_token(), name: "f".to_string(), args: vec![] }, true)]
     #[case(RuntimeError::InvalidNumberOfArguments { token: eof_token(), name: "f".to_string(), expected: 1, actual: 0 }, true)]
     #[case(RuntimeError::InvalidRegularExpression(eof_token(), "pat".to_string()), true)]
@@ -186,6 +190,7 @@ mod tests {
         RuntimeError::Timeout(Duration::from_millis(1500)),
         "Execution timed out after 1.500s"
     )]
+    #[case(RuntimeError::Interrupted, "Execution was interrupted")]
     #[case(RuntimeError::RecursionLimit, "Maximum macro recursion depth exceeded")]
     #[case(RuntimeError::UndefinedMacro(Ident::new("foo")), "Undefined macro: foo")]
     #[case(RuntimeError::ArityMismatch { macro_name: Ident::new("bar"), expected: 2, got: 1 }, "Macro bar expects 2 arguments, got 1")]
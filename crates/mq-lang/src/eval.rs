@@ -1,6 +1,7 @@
 use std::borrow::Cow;
 use std::collections::BTreeMap;
-use std::sync::LazyLock;
+use std::sync::atomic::{AtomicBool, Ordering};
+use std::sync::{Arc, LazyLock};
 use std::time::Duration;
 #[cfg(not(target_arch = "wasm32"))]
 use std::time::Instant;
@@ -165,6 +166,8 @@ pub struct Evaluator<T: ModuleResolver = DefaultModuleResolver> {
     deadline: Option<Instant>,
     /// Step counter so `Instant::now()` is only sampled every `TIMEOUT_CHECK_INTERVAL` steps.
     timeout_step: u32,
+    /// Set from another thread via [`InterruptHandle`](crate::InterruptHandle) to stop the current `eval` call.
+    pub(crate) interrupted: Arc<AtomicBool>,
     pub(crate) options: Options,
     pub(crate) module_loader: module::ModuleLoader<T>,
     pub(crate) macro_expander: Macro,
@@ -183,6 +186,7 @@ impl<T: ModuleResolver> Default for Evaluator<T> {
             call_stack_depth: 0,
             deadline: None,
             timeout_step: 0,
+            interrupted: Arc::new(AtomicBool::new(false)),
             options: Options::default(),
             module_loader: module::ModuleLoader::new(T::default()),
             macro_expander: Macro::new(),
@@ -203,6 +207,7 @@ impl<T: ModuleResolver> Clone for Evaluator<T> {
             call_stack_depth: self.call_stack_depth,
             deadline: self.deadline,
             timeout_step: self.timeout_step,
+            interrupted: Arc::clone(&self.interrupted),
             options: self.options.clone(),
             module_loader: self.module_loader.clone(),
             macro_expander: self.macro_expander.clone(),
@@ -1074,7 +1079,7 @@ impl<T: ModuleResolver> Evaluator<T> {
                         acc.push_str(&value.to_string());
                     }
                     ast::StringSegment::Env(env_var) => {
-                        acc.push_str(&std::env::var(env_var).map_err(|_| {
+                        acc.push_str(&builtin::capability::env_var(env_var).ok_or_else(|| {
                             RuntimeError::EnvNotFound(
                                 (*get_token(Shared::clone(&self.token_arena), token_id)).clone(),
                                 env_var.clone(),
@@ -1219,8 +1224,8 @@ impl<T: ModuleResolver> Evaluator<T> {
                             acc.push_str(&runtime_value.to_string());
                         } else if let Some(var) = expr_str.strip_prefix('$') {
                             acc.push_str(
-                                &std::env::var(var)
-                                    .map_err(|_| RuntimeError::EnvNotFound((**token).clone(), var.into()))?,
+                                &builtin::capability::env_var(var)
+                                    .ok_or_else(|| RuntimeError::EnvNotFound((**token).clone(), var.into()))?,
                             );
                         } else {
                             let value = self.eval_debug_expr(expr_str, token, env)?;
@@ -2069,24 +2074,23 @@ impl<T: ModuleResolver> Evaluator<T> {
         }
     }
 
-    /// Checks the configured `timeout`; a no-op when unset.
+    /// Checks the configured `timeout` and whether an interrupt has been requested.
     #[inline(always)]
     fn check_timeout(&mut self) -> Result<(), RuntimeError> {
-        let Some(deadline) = self.deadline else {
-            return Ok(());
-        };
-
         self.timeout_step = self.timeout_step.wrapping_add(1);
         if self.timeout_step & (TIMEOUT_CHECK_INTERVAL - 1) != 0 {
             return Ok(());
         }
 
-        if Instant::now() >= deadline {
-            Err(RuntimeError::Timeout(
+        if self.interrupted.load(Ordering::Relaxed) {
+            return Err(RuntimeError::Interrupted);
+        }
+
+        match self.deadline {
+            Some(deadline) if Instant::now() >= deadline => Err(RuntimeError::Timeout(
                 self.options.timeout.expect("deadline implies options.timeout is set"),
-            ))
-        } else {
-            Ok(())
+            )),
+            _ => Ok(()),
         }
     }
 
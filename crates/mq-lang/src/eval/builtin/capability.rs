@@ -9,15 +9,52 @@
 //! keeps the model symmetric: a third-party module fetched via HTTP import can't silently read
 //! or write local files, or reach the network, without the host opting in to each capability.
 //!
+//! Environment variable access (`$NAME`) is the one exception: it defaults to `true` for
+//! backwards compatibility, and embedders running untrusted queries can turn it off with
+//! [`set_allow_env`].
+//!
 //! This is process-wide rather than per-[`Engine`](crate::Engine): like the `file-io` Cargo
 //! feature that gates these functions at compile time, filesystem/network access is a
 //! deployment-level decision, not something a single process needs to vary per query.
+//!
+//! A sandboxed [`Engine`](crate::Engine) (see [`Engine::set_sandbox`](crate::Engine::set_sandbox))
+//! additionally denies all four capabilities while it is parsing or evaluating, whatever the
+//! process-wide flags say, so a host can run untrusted queries next to trusted ones.
 
+use std::cell::Cell;
 use std::sync::atomic::{AtomicBool, Ordering};
 
 static NET_ALLOWED: AtomicBool = AtomicBool::new(false);
 static READ_ALLOWED: AtomicBool = AtomicBool::new(false);
 static WRITE_ALLOWED: AtomicBool = AtomicBool::new(false);
+static ENV_ALLOWED: AtomicBool = AtomicBool::new(true);
+
+thread_local! {
+    static SANDBOXED: Cell<bool> = const { Cell::new(false) };
+}
+
+/// Marks the current thread as running a sandboxed engine until dropped.
+///
+/// Entered by [`Engine`](crate::Engine) around each parse and evaluation. Entering with
+/// `false` is a no-op apart from restoring the previous state on drop, which keeps nested
+/// calls on the same thread correct.
+pub(crate) struct SandboxScope(bool);
+
+impl SandboxScope {
+    pub(crate) fn enter(sandboxed: bool) -> Self {
+        Self(SANDBOXED.replace(sandboxed))
+    }
+}
+
+impl Drop for SandboxScope {
+    fn drop(&mut self) {
+        SANDBOXED.set(self.0);
+    }
+}
+
+fn is_sandboxed() -> bool {
+    SANDBOXED.get()
+}
 
 /// Enables or disables `http` for the current process.
 pub fn set_allow_net(allow: bool) {
@@ -34,17 +71,34 @@ pub fn set_allow_write(allow: bool) {
     WRITE_ALLOWED.store(allow, Ordering::Relaxed);
 }
 
+/// Enables or disables environment variable access for the current process.
+pub fn set_allow_env(allow: bool) {
+    ENV_ALLOWED.store(allow, Ordering::Relaxed);
+}
+
+/// Reads an environment variable, or `None` if it is unset or environment access is disabled.
+///
+/// A disabled environment looks empty to mq code, so references fail with the usual
+/// "environment variable not found" error instead of leaking host configuration.
+pub(crate) fn env_var(name: &str) -> Option<String> {
+    if ENV_ALLOWED.load(Ordering::Relaxed) && !is_sandboxed() {
+        std::env::var(name).ok()
+    } else {
+        None
+    }
+}
+
 #[cfg(feature = "http")]
 pub(crate) fn is_net_allowed() -> bool {
-    NET_ALLOWED.load(Ordering::Relaxed)
+    NET_ALLOWED.load(Ordering::Relaxed) && !is_sandboxed()
 }
 
 #[cfg(feature = "file-io")]
 pub(crate) fn is_read_allowed() -> bool {
-    READ_ALLOWED.load(Ordering::Relaxed)
+    READ_ALLOWED.load(Ordering::Relaxed) && !is_sandboxed()
 }
 
 #[cfg(feature = "file-io")]
 pub(crate) fn is_write_allowed() -> bool {
-    WRITE_ALLOWED.load(Ordering::Relaxed)
+    WRITE_ALLOWED.load(Ordering::Relaxed) && !is_sandboxed()
 }
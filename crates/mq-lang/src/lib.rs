@@ -79,6 +79,7 @@ pub use ast::parser::Parser as AstParser;
 pub use ast::{ast_from_json, ast_to_json};
 pub use engine::CompiledProgram;
 pub use engine::Engine;
+pub use engine::InterruptHandle;
 pub use error::Error;
 pub use eval::builtin::{
     BUILTIN_FUNCTION_DOC, BUILTIN_SELECTOR_DOC, BuiltinFunctionDoc, BuiltinSelectorDoc, INTERNAL_FUNCTION_DOC,
@@ -185,6 +186,27 @@ pub fn parse(code: &str, token_arena: TokenArena) -> Result<Program, Box<error::
     .map_err(|e| Box::new(error::Error::from_error(code, e.into(), DefaultModuleLoader::default())))
 }
 
+/// Tokenizes mq code, e.g. for syntax highlighting.
+///
+/// Lexing errors are tolerated so that partially typed code still yields tokens.
+/// Comments are included; whitespace, newlines, and the end-of-input token are not.
+pub fn tokenize(code: &str) -> Vec<Token> {
+    Lexer::new(lexer::Options {
+        ignore_errors: true,
+        include_spaces: true,
+    })
+    .tokenize(code, Module::TOP_LEVEL_MODULE_ID)
+    .unwrap_or_default()
+    .into_iter()
+    .filter(|token| {
+        !matches!(
+            token.kind,
+            TokenKind::Whitespace(_) | TokenKind::Tab(_) | TokenKind::NewLine | TokenKind::Eof
+        )
+    })
+    .collect()
+}
+
 /// Parses an MDX string and returns an iterator over `Value` nodes.
 pub fn parse_mdx_input(input: &str) -> miette::Result<Vec<RuntimeValue>> {
     let mdx = mq_markdown::Markdown::from_mdx_str(input)?;
@@ -260,6 +282,20 @@ pub(crate) fn get_token(arena: TokenArena, token_id: TokenId) -> Shared<Token> {
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_tokenize_keeps_comments_and_skips_whitespace() {
+        let tokens = tokenize("let x = .h1 # heading\n| x");
+
+        assert_eq!(tokens.len(), 7);
+        assert!(matches!(tokens[0].kind, TokenKind::Let));
+        assert!(matches!(&tokens[1].kind, TokenKind::Ident(name) if name == "x"));
+        assert!(matches!(tokens[2].kind, TokenKind::Equal));
+        assert!(matches!(&tokens[3].kind, TokenKind::Selector(selector) if selector == ".h1"));
+        assert!(matches!(&tokens[4].kind, TokenKind::Comment(comment) if comment == " heading"));
+        assert!(matches!(tokens[5].kind, TokenKind::Pipe));
+        assert_eq!(tokens[6].range.start.line, 2);
+    }
+
     #[test]
     fn test_eval_basic() {
         let code = "add(\"world!\")";
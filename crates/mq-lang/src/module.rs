@@ -64,6 +64,8 @@ pub struct ModuleLoader<T: ModuleResolver = DefaultModuleResolver> {
     pub(crate) source_code: Option<String>,
     source_cache: FxHashMap<SmolStr, String>,
     resolver: T,
+    /// When set, only standard library modules are resolved; filesystem and HTTP sources are blocked.
+    sandboxed: bool,
     /// Tracks sub-module loading depth; HTTP imports are blocked when this is greater than zero.
     #[cfg(feature = "http-import")]
     http_depth: usize,
@@ -127,6 +129,7 @@ impl<T: ModuleResolver> ModuleLoader<T> {
             source_code: None,
             source_cache: FxHashMap::default(),
             resolver,
+            sandboxed: false,
             #[cfg(feature = "http-import")]
             http_depth: 0,
         }
@@ -161,6 +164,11 @@ impl<T: ModuleResolver> ModuleLoader<T> {
         self.resolver.set_search_paths(paths);
     }
 
+    /// Restricts module resolution to standard library modules.
+    pub fn set_sandboxed(&mut self, sandboxed: bool) {
+        self.sandboxed = sandboxed;
+    }
+
     pub fn load(&mut self, module_name: &str, code: &str, token_arena: TokenArena) -> Result<Module, ModuleError> {
         if self.loaded_modules.contains(module_name.into()) {
             return Err(ModuleError::AlreadyLoaded(Cow::Owned(module_name.to_string())));
@@ -240,6 +248,12 @@ impl<T: ModuleResolver> ModuleLoader<T> {
     }
 
     pub fn resolve(&self, module_name: &str) -> Result<String, ModuleError> {
+        if self.sandboxed {
+            return STANDARD_MODULES
+                .get(module_name)
+                .map(|f| f().to_string())
+                .ok_or_else(|| ModuleError::NotAllowedInSandbox(Cow::Owned(module_name.to_string())));
+        }
         #[cfg(feature = "http-import")]
         if self.http_depth > 0
             && (resolver::http_import::is_remote_url(module_name) || resolver::http_import::is_github_url(module_name))
@@ -702,6 +716,26 @@ mod tests {
         }
     }
 
+    #[test]
+    fn test_resolve_sandboxed_allows_standard_modules() {
+        let mut loader = ModuleLoader::new(DefaultModuleResolver::new(vec![]));
+        loader.set_sandboxed(true);
+        assert!(loader.resolve("csv").is_ok());
+    }
+
+    #[rstest]
+    #[case::local_file("mq_sandbox_local")]
+    #[case::http_url("https://example.com/foo.mq")]
+    fn test_resolve_sandboxed_blocks_other_modules(#[case] name: &str) {
+        let dir = tempfile::tempdir().unwrap();
+        std::fs::write(dir.path().join("mq_sandbox_local.mq"), "def f(): 1;").unwrap();
+        let mut loader = ModuleLoader::new(DefaultModuleResolver::new(vec![dir.path().to_path_buf()]));
+        assert!(loader.resolve("mq_sandbox_local").is_ok());
+
+        loader.set_sandboxed(true);
+        assert!(matches!(loader.resolve(name), Err(ModuleError::NotAllowedInSandbox(_))));
+    }
+
     #[cfg(feature = "http-import")]
     #[rstest]
     #[case("https://example.com/foo.mq")]
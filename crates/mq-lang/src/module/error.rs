@@ -17,6 +17,9 @@ pub enum ModuleError {
     SyntaxError(#[from] SyntaxError),
     #[error("Invalid module, expected IDENT or BINDING")]
     InvalidModule,
+    /// Only standard library modules can be resolved while the engine is sandboxed.
+    #[error("Module `{0}` is not allowed in sandbox mode; only standard library modules can be loaded")]
+    NotAllowedInSandbox(Cow<'static, str>),
     /// HTTP imports are only permitted at the top level; modules may not fetch remote dependencies.
     #[cfg(feature = "http-import")]
     #[error(
@@ -35,6 +38,7 @@ impl ModuleError {
             ModuleError::IOError(_) => None,
             ModuleError::SyntaxError(err) => err.token(),
             ModuleError::InvalidModule => None,
+            ModuleError::NotAllowedInSandbox(_) => None,
             #[cfg(feature = "http-import")]
             ModuleError::HttpImportNotAllowed(_) => None,
         }
@@ -171,6 +171,15 @@ impl Markdown {
         markdown::to_html_with_options(&md_str, &html_options()).unwrap_or_else(|_| markdown::to_html(&md_str))
     }
 
+    /// Renders to HTML like [`Markdown::to_html`], but escapes raw HTML in the markdown
+    /// instead of passing it through, for output that ends up in a page shown to others.
+    pub fn to_safe_html(&self) -> String {
+        let md_str = self.to_string();
+        let mut options = html_options();
+        options.compile.allow_dangerous_html = false;
+        markdown::to_html_with_options(&md_str, &options).unwrap_or_else(|_| markdown::to_html(&md_str))
+    }
+
     pub fn to_text(&self) -> String {
         let mut result = String::with_capacity(self.nodes.len() * 20); // Reasonable estimate
         for node in &self.nodes {
@@ -190,6 +199,14 @@ impl Markdown {
         serde_json::to_string_pretty(&nodes).map_err(|e| miette!("Failed to serialize to JSON: {}", e))
     }
 
+    /// Builds a document from the JSON AST produced by [`Markdown::to_json`].
+    #[cfg(feature = "json")]
+    pub fn from_json(content: &str) -> miette::Result<Self> {
+        let nodes: Vec<Node> =
+            serde_json::from_str(content).map_err(|e| miette!("Failed to deserialize from JSON: {}", e))?;
+        Ok(Self::new(nodes))
+    }
+
     #[cfg(feature = "html-to-markdown")]
     pub fn from_html_str(content: &str) -> miette::Result<Self> {
         Self::from_html_str_with_options(content, ConversionOptions::default())
@@ -669,6 +686,23 @@ mod tests {
         );
     }
 
+    #[test]
+    fn test_to_safe_html_escapes_raw_html() {
+        let md = "<script>alert(1)</script>\n\nSome **bold** text"
+            .parse::<Markdown>()
+            .unwrap();
+        let html = md.to_safe_html();
+        assert!(!html.contains("<script>"), "expected raw HTML to be escaped in: {html}");
+        assert!(
+            html.contains("&lt;script&gt;"),
+            "expected escaped script tag in: {html}"
+        );
+        assert!(
+            html.contains("<strong>bold</strong>"),
+            "expected markdown to be rendered in: {html}"
+        );
+    }
+
     #[test]
     fn test_to_html_standalone_gfm_table() {
         let input = "| H1 | H2 |\n|---|---|\n| a | b |";
@@ -910,6 +944,22 @@ mod json_tests {
         assert!(json.contains("\"type\": \"TableCell\""));
     }
 
+    #[rstest]
+    #[case("# Hello\n")]
+    #[case("# Hello\n\n- Item 1\n- Item 2\n")]
+    #[case("```rust\nfn main() {}\n```\n")]
+    fn test_from_json_roundtrip(#[case] input: &str) {
+        let md = input.parse::<Markdown>().unwrap();
+        let restored = Markdown::from_json(&md.to_json().unwrap()).unwrap();
+
+        assert_eq!(restored.to_string(), md.to_string());
+    }
+
+    #[test]
+    fn test_from_json_invalid() {
+        assert!(Markdown::from_json("{").is_err());
+    }
+
     #[rstest]
     #[case("<h1>Hello</h1>", 1, "# Hello\n")]
     #[case("<p>Paragraph</p>", 1, "Paragraph\n")]